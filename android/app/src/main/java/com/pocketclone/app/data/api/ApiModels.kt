@@ -11,7 +11,17 @@ data class Article(
     @SerializedName("author") val author: String?,
     @SerializedName("image") val image: String?,
     @SerializedName("archived") val archived: Boolean,
-    @SerializedName("created_at") val createdAt: String?
+    @SerializedName("created_at") val createdAt: String?,
+    @SerializedName("text_content") val textContent: String? = null,
+    @SerializedName("progress") val progress: Double = 0.0,
+    @SerializedName("read_state") val readState: String = "unread",
+    @SerializedName("favorite") val favorite: Boolean = false
+)
+
+data class ArticlePage(
+    @SerializedName("articles") val articles: List<Article>,
+    @SerializedName("next_cursor") val nextCursor: String? = null,
+    @SerializedName("total") val total: Int? = null
 )
 
 data class CreateArticleRequest(
@@ -19,5 +29,20 @@ data class CreateArticleRequest(
 )
 
 data class UpdateArticleRequest(
-    @SerializedName("archived") val archived: Boolean? = null
+    @SerializedName("archived") val archived: Boolean? = null,
+    @SerializedName("read_state") val readState: String? = null,
+    @SerializedName("favorite") val favorite: Boolean? = null
+)
+
+data class UpdateProgressRequest(
+    @SerializedName("percent") val percent: Double? = null,
+    @SerializedName("offset") val offset: Int? = null,
+    @SerializedName("updated_at") val updatedAt: String? = null,
+    @SerializedName("opened_at") val openedAt: String? = null
+)
+
+data class ProgressResponse(
+    @SerializedName("percent") val percent: Double,
+    @SerializedName("offset") val offset: Int,
+    @SerializedName("applied") val applied: Boolean
 )
@@ -11,8 +11,8 @@ interface PocketApi {
     suspend fun getArticles(
         @Query("archived") archived: Boolean? = null,
         @Query("limit") limit: Int = 50,
-        @Query("offset") offset: Int = 0
-    ): List<Article>
+        @Query("cursor") cursor: String? = null
+    ): ArticlePage
 
     @GET("api/articles/{id}")
     suspend fun getArticle(@Path("id") id: Long): Article
@@ -23,12 +23,19 @@ interface PocketApi {
         @Body request: UpdateArticleRequest
     )
 
+    @PATCH("api/articles/{id}/progress")
+    suspend fun updateProgress(
+        @Path("id") id: Long,
+        @Body request: UpdateProgressRequest
+    ): ProgressResponse
+
     @DELETE("api/articles/{id}")
     suspend fun deleteArticle(@Path("id") id: Long)
 
     @GET("api/search")
     suspend fun search(
         @Query("q") query: String,
-        @Query("limit") limit: Int = 20
-    ): List<Article>
+        @Query("limit") limit: Int = 20,
+        @Query("cursor") cursor: String? = null
+    ): ArticlePage
 }
@@ -4,10 +4,12 @@ import com.pocketclone.app.data.api.Article
 import com.pocketclone.app.data.api.CreateArticleRequest
 import com.pocketclone.app.data.api.PocketApi
 import com.pocketclone.app.data.api.UpdateArticleRequest
+import com.pocketclone.app.data.api.UpdateProgressRequest
 import com.pocketclone.app.data.db.ArticleDao
 import com.pocketclone.app.data.db.ArticleEntity
 import kotlinx.coroutines.flow.Flow
 import kotlinx.coroutines.flow.map
+import java.time.Instant
 import javax.inject.Inject
 import javax.inject.Singleton
 
@@ -42,8 +44,12 @@ class ArticleRepository @Inject constructor(
 
     suspend fun refreshArticles(archived: Boolean? = null) {
         try {
-            val articles = api.getArticles(archived = archived)
-            dao.insertArticles(articles.map { ArticleEntity.fromArticle(it) })
+            var cursor: String? = null
+            do {
+                val page = api.getArticles(archived = archived, cursor = cursor)
+                dao.insertArticles(page.articles.map { ArticleEntity.fromArticle(it) })
+                cursor = page.nextCursor
+            } while (cursor != null)
         } catch (e: Exception) {
             // Ignore network errors, use cached data
         }
@@ -69,6 +75,47 @@ class ArticleRepository @Inject constructor(
         }
     }
 
+    suspend fun setFavorite(id: Long, favorite: Boolean): Result<Unit> {
+        return try {
+            api.updateArticle(id, UpdateArticleRequest(favorite = favorite))
+            Result.success(Unit)
+        } catch (e: Exception) {
+            Result.failure(e)
+        }
+    }
+
+    suspend fun setReadState(id: Long, readState: String): Result<Unit> {
+        return try {
+            api.updateArticle(id, UpdateArticleRequest(readState = readState))
+            Result.success(Unit)
+        } catch (e: Exception) {
+            Result.failure(e)
+        }
+    }
+
+    suspend fun markOpened(id: Long) {
+        try {
+            api.updateProgress(id, UpdateProgressRequest(openedAt = Instant.now().toString()))
+        } catch (e: Exception) {
+            // Progress is best effort
+        }
+    }
+
+    suspend fun saveProgress(id: Long, percent: Double, offset: Int) {
+        try {
+            api.updateProgress(
+                id,
+                UpdateProgressRequest(
+                    percent = percent,
+                    offset = offset,
+                    updatedAt = Instant.now().toString()
+                )
+            )
+        } catch (e: Exception) {
+            // Progress is best effort; a newer position from another device wins anyway
+        }
+    }
+
     suspend fun deleteArticle(id: Long): Result<Unit> {
         return try {
             api.deleteArticle(id)
@@ -41,27 +41,27 @@ object AppModule {
         val dynamicBaseUrlInterceptor = Interceptor { chain ->
             val originalRequest = chain.request()
 
-            // Get current server URL from DataStore
-            val serverUrl = runBlocking {
-                val prefs = dataStore.data.first()
-                prefs[SettingsKeys.SERVER_URL] ?: "http://10.0.2.2:8080"
-            }.removeSuffix("/")
+            // Get current server URL and API token from DataStore
+            val prefs = runBlocking { dataStore.data.first() }
+            val serverUrl = (prefs[SettingsKeys.SERVER_URL] ?: "http://10.0.2.2:8080").removeSuffix("/")
+            val apiToken = prefs[SettingsKeys.API_TOKEN].orEmpty()
+
+            val requestBuilder = originalRequest.newBuilder()
+            if (apiToken.isNotBlank()) {
+                requestBuilder.header("Authorization", "Bearer $apiToken")
+            }
 
             val newUrl = serverUrl.toHttpUrlOrNull()
             if (newUrl != null) {
-                val newRequest = originalRequest.newBuilder()
-                    .url(
-                        originalRequest.url.newBuilder()
-                            .scheme(newUrl.scheme)
-                            .host(newUrl.host)
-                            .port(newUrl.port)
-                            .build()
-                    )
-                    .build()
-                chain.proceed(newRequest)
-            } else {
-                chain.proceed(originalRequest)
+                requestBuilder.url(
+                    originalRequest.url.newBuilder()
+                        .scheme(newUrl.scheme)
+                        .host(newUrl.host)
+                        .port(newUrl.port)
+                        .build()
+                )
             }
+            chain.proceed(requestBuilder.build())
         }
 
         return OkHttpClient.Builder()
@@ -108,4 +108,5 @@ object AppModule {
 
 object SettingsKeys {
     val SERVER_URL = androidx.datastore.preferences.core.stringPreferencesKey("server_url")
+    val API_TOKEN = androidx.datastore.preferences.core.stringPreferencesKey("api_token")
 }
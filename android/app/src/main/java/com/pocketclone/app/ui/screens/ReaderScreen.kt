@@ -23,8 +23,11 @@ import coil.compose.AsyncImage
 import com.pocketclone.app.data.api.Article
 import com.pocketclone.app.data.repository.ArticleRepository
 import dagger.hilt.android.lifecycle.HiltViewModel
+import kotlinx.coroutines.FlowPreview
 import kotlinx.coroutines.flow.MutableStateFlow
 import kotlinx.coroutines.flow.StateFlow
+import kotlinx.coroutines.flow.debounce
+import kotlinx.coroutines.flow.distinctUntilChanged
 import kotlinx.coroutines.launch
 import javax.inject.Inject
 
@@ -54,6 +57,13 @@ class ReaderViewModel @Inject constructor(
             _isLoading.value = true
             _article.value = repository.getArticle(articleId)
             _isLoading.value = false
+            repository.markOpened(articleId)
+        }
+    }
+
+    fun saveProgress(percent: Double, textLength: Int) {
+        viewModelScope.launch {
+            repository.saveProgress(articleId, percent, (textLength * percent / 100).toInt())
         }
     }
 
@@ -75,7 +85,7 @@ class ReaderViewModel @Inject constructor(
     }
 }
 
-@OptIn(ExperimentalMaterial3Api::class)
+@OptIn(ExperimentalMaterial3Api::class, FlowPreview::class)
 @Composable
 fun ReaderScreen(
     onBack: () -> Unit,
@@ -86,6 +96,7 @@ fun ReaderScreen(
     val textSize by viewModel.textSize.collectAsState()
     val uriHandler = LocalUriHandler.current
     var showTextSizeMenu by remember { mutableStateOf(false) }
+    val scrollState = rememberScrollState()
 
     Scaffold(
         topBar = {
@@ -157,11 +168,32 @@ fun ReaderScreen(
             }
         } else {
             article?.let { art ->
+                // Resume where we stopped once the content has been laid out,
+                // then save the position whenever scrolling settles
+                LaunchedEffect(art.id, scrollState.maxValue > 0) {
+                    if (scrollState.maxValue > 0 && art.progress > 0 && art.progress < 100) {
+                        scrollState.scrollTo((scrollState.maxValue * art.progress / 100).toInt())
+                    }
+                }
+                LaunchedEffect(art.id) {
+                    snapshotFlow { scrollState.value }
+                        .distinctUntilChanged()
+                        .debounce(2000)
+                        .collect { value ->
+                            val percent = if (scrollState.maxValue > 0) {
+                                value * 100.0 / scrollState.maxValue
+                            } else {
+                                100.0
+                            }
+                            viewModel.saveProgress(percent, art.textContent?.length ?: 0)
+                        }
+                }
+
                 Column(
                     modifier = Modifier
                         .fillMaxSize()
                         .padding(padding)
-                        .verticalScroll(rememberScrollState())
+                        .verticalScroll(scrollState)
                 ) {
                     // Hero image
                     if (!art.image.isNullOrEmpty()) {
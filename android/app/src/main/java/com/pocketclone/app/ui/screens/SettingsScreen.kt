@@ -9,6 +9,7 @@ import androidx.compose.runtime.*
 import androidx.compose.ui.Alignment
 import androidx.compose.ui.Modifier
 import androidx.compose.ui.text.input.KeyboardType
+import androidx.compose.ui.text.input.PasswordVisualTransformation
 import androidx.compose.ui.unit.dp
 import androidx.datastore.core.DataStore
 import androidx.datastore.preferences.core.Preferences
@@ -32,6 +33,9 @@ class SettingsViewModel @Inject constructor(
     private val _serverUrl = MutableStateFlow("")
     val serverUrl: StateFlow<String> = _serverUrl
 
+    private val _apiToken = MutableStateFlow("")
+    val apiToken: StateFlow<String> = _apiToken
+
     private val _isTesting = MutableStateFlow(false)
     val isTesting: StateFlow<Boolean> = _isTesting
 
@@ -45,6 +49,7 @@ class SettingsViewModel @Inject constructor(
         viewModelScope.launch {
             dataStore.data.collect { prefs ->
                 _serverUrl.value = prefs[SettingsKeys.SERVER_URL] ?: "http://10.0.2.2:8080"
+                _apiToken.value = prefs[SettingsKeys.API_TOKEN] ?: ""
             }
         }
     }
@@ -55,11 +60,19 @@ class SettingsViewModel @Inject constructor(
         _testResult.value = null
     }
 
+    fun setApiToken(token: String) {
+        _apiToken.value = token
+        _isSaved.value = false
+        _testResult.value = null
+    }
+
     fun saveSettings() {
         viewModelScope.launch {
             val url = _serverUrl.value.trim().removeSuffix("/")
+            val token = _apiToken.value.trim()
             dataStore.edit { prefs ->
                 prefs[SettingsKeys.SERVER_URL] = url
+                prefs[SettingsKeys.API_TOKEN] = token
             }
             _isSaved.value = true
         }
@@ -100,6 +113,7 @@ fun SettingsScreen(
     viewModel: SettingsViewModel = hiltViewModel()
 ) {
     val serverUrl by viewModel.serverUrl.collectAsState()
+    val apiToken by viewModel.apiToken.collectAsState()
     val isTesting by viewModel.isTesting.collectAsState()
     val testResult by viewModel.testResult.collectAsState()
     val isSaved by viewModel.isSaved.collectAsState()
@@ -150,6 +164,17 @@ fun SettingsScreen(
                         }
                     )
 
+                    OutlinedTextField(
+                        value = apiToken,
+                        onValueChange = viewModel::setApiToken,
+                        label = { Text("API Token") },
+                        placeholder = { Text("pc_...") },
+                        singleLine = true,
+                        visualTransformation = PasswordVisualTransformation(),
+                        keyboardOptions = KeyboardOptions(keyboardType = KeyboardType.Password),
+                        modifier = Modifier.fillMaxWidth()
+                    )
+
                     Row(
                         modifier = Modifier.fillMaxWidth(),
                         horizontalArrangement = Arrangement.spacedBy(8.dp)
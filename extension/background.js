@@ -19,7 +19,7 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
 });
 
 async function saveArticle(url) {
-  const { serverUrl } = await chrome.storage.sync.get(['serverUrl']);
+  const { serverUrl, apiToken } = await chrome.storage.sync.get(['serverUrl', 'apiToken']);
 
   if (!serverUrl) {
     throw new Error('Server URL not configured. Please set it in extension options.');
@@ -29,6 +29,7 @@ async function saveArticle(url) {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
+      ...(apiToken ? { 'Authorization': `Bearer ${apiToken}` } : {}),
     },
     body: JSON.stringify({ url }),
   });
@@ -2,18 +2,23 @@
 
 document.addEventListener('DOMContentLoaded', async () => {
   const serverUrlInput = document.getElementById('server-url');
+  const apiTokenInput = document.getElementById('api-token');
   const saveBtn = document.getElementById('save-btn');
   const statusEl = document.getElementById('status');
 
   // Load saved settings
-  const { serverUrl } = await chrome.storage.sync.get(['serverUrl']);
+  const { serverUrl, apiToken } = await chrome.storage.sync.get(['serverUrl', 'apiToken']);
   if (serverUrl) {
     serverUrlInput.value = serverUrl;
   }
+  if (apiToken) {
+    apiTokenInput.value = apiToken;
+  }
 
   // Save settings
   saveBtn.addEventListener('click', async () => {
     const url = serverUrlInput.value.trim();
+    const token = apiTokenInput.value.trim();
 
     // Validate URL
     if (!url) {
@@ -38,7 +43,10 @@ document.addEventListener('DOMContentLoaded', async () => {
     try {
       const response = await fetch(`${normalizedUrl}/api/articles?limit=1`, {
         method: 'GET',
-        headers: { 'Content-Type': 'application/json' },
+        headers: {
+          'Content-Type': 'application/json',
+          ...(token ? { 'Authorization': `Bearer ${token}` } : {}),
+        },
       });
 
       if (!response.ok) {
@@ -46,7 +54,7 @@ document.addEventListener('DOMContentLoaded', async () => {
       }
 
       // Save to storage
-      await chrome.storage.sync.set({ serverUrl: normalizedUrl });
+      await chrome.storage.sync.set({ serverUrl: normalizedUrl, apiToken: token });
       showStatus('Settings saved! Connection to server verified.', 'success');
     } catch (err) {
       showStatus(`Cannot connect to server: ${err.message}`, 'error');
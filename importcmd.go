@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/importer"
+	"pocket-clone/internal/ingest"
+	"pocket-clone/internal/storage"
+)
+
+// runImport implements "pocket-clone import", which loads an export file
+// from Pocket, Instapaper or Omnivore into a user's library.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "./pocket.db", "Database file path")
+	username := fs.String("user", "", "Account to import into")
+	format := fs.String("format", "", "Export format: pocket-html, pocket-csv, instapaper or omnivore (default: detect)")
+	workers := fs.Int("workers", 4, "Number of concurrent article fetchers")
+	fetchNow := fs.Bool("fetch", true, "Fetch imported articles now instead of leaving them for the server")
+	singleFile := fs.Bool("single-file", false, "Also store self-contained snapshots with stylesheets and images inlined")
+	rulesDir := fs.String("rules", "", "Directory of site extraction rules (host.txt files)")
+	allowPrivate := fs.Bool("allow-private", false, "Allow fetching from loopback, private and link-local addresses")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pocket-clone import -user NAME [flags] FILE")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *username == "" || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadSiteRules(*rulesDir)
+	fetch.AllowPrivate = *allowPrivate
+
+	db, err := storage.NewSQLiteDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	user, _, err := db.GetUserByUsername(ctx, *username)
+	if err != nil {
+		log.Fatalf("Unknown user %q: %v", *username, err)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open export: %v", err)
+	}
+	items, err := importer.Parse(file, *format)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Failed to read export: %v", err)
+	}
+
+	// Without -fetch the articles stay pending until the server starts
+	var queue *ingest.Queue
+	var fetched, failed atomic.Int64
+	if *fetchNow {
+		queue = ingest.New(db, *workers)
+		queue.SingleFile = *singleFile
+		queue.OnProcessed = func(id int64, err error) {
+			if err != nil {
+				failed.Add(1)
+			}
+			log.Printf("Fetched %d articles (%d failed)", fetched.Add(1), failed.Load())
+		}
+		queue.Start()
+	}
+
+	summary := importer.Import(ctx, db, queue, user.ID, items, func(p importer.Progress) {
+		if p.Processed%100 == 0 || p.Processed == p.Total {
+			log.Printf("Imported %d/%d", p.Processed, p.Total)
+		}
+	})
+
+	log.Printf("Import finished: %d imported, %d duplicates, %d failed", summary.Imported, summary.Duplicates, summary.Failed)
+	for _, f := range summary.Failures {
+		log.Printf("  %s: %s", f.URL, f.Error)
+	}
+
+	if queue != nil {
+		queue.Wait()
+		queue.Stop()
+		log.Printf("Fetching finished: %d fetched, %d failed", fetched.Load()-failed.Load(), failed.Load())
+	}
+}
@@ -0,0 +1,183 @@
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/storage"
+)
+
+const (
+	// PathPrefix is where archived assets are served from
+	PathPrefix = "/api/assets/"
+
+	// maxAssetSize caps each downloaded image
+	maxAssetSize = 10 << 20
+
+	// maxAssetsPerArticle stops galleries from taking over the database
+	maxAssetsPerArticle = 100
+)
+
+// fetcher downloads images. It accepts any type as servers often mislabel
+// images; download checks the bytes instead.
+var fetcher = fetch.New(maxAssetSize)
+
+// Path returns the URL path an asset is served from
+func Path(hash string) string {
+	return PathPrefix + hash
+}
+
+// HashFromPath returns the asset hash of a URL written by Archive
+func HashFromPath(src string) (string, bool) {
+	hash, ok := strings.CutPrefix(src, PathPrefix)
+	if !ok || len(hash) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// Archive downloads the images referenced by an article and stores them in
+// the database, rewriting the article's content and lead image to point at
+// the local copies. Images that can't be downloaded keep their original URL.
+func Archive(ctx context.Context, db *storage.SQLiteDB, articleID int64, article *storage.Article) error {
+	downloaded := map[string]string{}
+	store := func(src string) string {
+		if local, ok := downloaded[src]; ok {
+			return local
+		}
+		if len(downloaded) >= maxAssetsPerArticle {
+			return ""
+		}
+
+		local := ""
+		asset, err := download(ctx, src)
+		if err == nil {
+			err = db.SaveAsset(ctx, articleID, asset, src)
+		}
+		if err != nil {
+			log.Printf("assets: article %d: %s: %v", articleID, src, err)
+		} else {
+			local = Path(asset.Hash)
+		}
+
+		downloaded[src] = local
+		return local
+	}
+
+	content, err := rewriteImages(article.Content, store)
+	if err != nil {
+		return err
+	}
+	article.Content = content
+
+	if article.ImageURL != "" {
+		if local := store(article.ImageURL); local != "" {
+			article.ImageURL = local
+		}
+	}
+
+	return nil
+}
+
+// rewriteImages replaces the src of every <img> in an HTML fragment with the
+// result of store, leaving it alone when store returns "". Responsive image
+// candidates are dropped from archived images so browsers use the local
+// copy.
+func rewriteImages(fragment string, store func(src string) string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			for i, a := range n.Attr {
+				if a.Key != "src" || !isRemote(a.Val) {
+					continue
+				}
+				if local := store(a.Val); local != "" {
+					n.Attr[i].Val = local
+					removeAttrs(n, "srcset", "sizes")
+					changed = true
+				}
+				break
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	if !changed {
+		return fragment, nil
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		if err := html.Render(&sb, n); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+func download(ctx context.Context, src string) (*storage.Asset, error) {
+	resp, err := fetcher.Get(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	data := resp.Body
+
+	mediaType := http.DetectContentType(data)
+	if !strings.HasPrefix(mediaType, "image/") {
+		// Sniffing doesn't recognise SVG, so fall back to the header
+		mediaType = resp.MediaType
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("not an image: %s", mediaType)
+	}
+
+	sum := sha256.Sum256(data)
+	return &storage.Asset{
+		Hash:      hex.EncodeToString(sum[:]),
+		MediaType: mediaType,
+		Data:      data,
+	}, nil
+}
+
+func isRemote(src string) bool {
+	u, err := url.Parse(src)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func removeAttrs(n *html.Node, keys ...string) {
+	kept := n.Attr[:0]
+outer:
+	for _, a := range n.Attr {
+		for _, k := range keys {
+			if a.Key == k {
+				continue outer
+			}
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+}
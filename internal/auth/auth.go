@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"pocket-clone/internal/storage"
+)
+
+type contextKey struct{}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user *storage.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user, or nil for anonymous
+// requests
+func UserFromContext(ctx context.Context) *storage.User {
+	user, _ := ctx.Value(contextKey{}).(*storage.User)
+	return user
+}
+
+// HashPassword hashes a password for storage
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// verifiedTTL is how long a successful password check is remembered.
+// Browsers resend Basic credentials with every request, and checking a
+// bcrypt hash each time would make every page load slow.
+const verifiedTTL = 5 * time.Minute
+
+// maxVerified bounds the number of remembered password checks
+const maxVerified = 1024
+
+// verifiedCache remembers passwords that recently matched a hash. Entries
+// are keyed by a digest of the hash and password together, so changing a
+// password takes effect at once, and the password itself isn't kept.
+type verifiedCache struct {
+	mu      sync.Mutex
+	expires map[[sha256.Size]byte]time.Time
+}
+
+func verifiedKey(hash, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(hash + "\x00" + password))
+}
+
+// check is CheckPassword, skipping bcrypt for a recent match
+func (c *verifiedCache) check(hash, password string) bool {
+	key := verifiedKey(hash, password)
+	now := time.Now()
+
+	c.mu.Lock()
+	expires, ok := c.expires[key]
+	c.mu.Unlock()
+	if ok && now.Before(expires) {
+		return true
+	}
+
+	if !CheckPassword(hash, password) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.expires) >= maxVerified {
+		for k, e := range c.expires {
+			if !now.Before(e) {
+				delete(c.expires, k)
+			}
+		}
+	}
+	if c.expires == nil || len(c.expires) >= maxVerified {
+		c.expires = make(map[[sha256.Size]byte]time.Time)
+	}
+	c.expires[key] = now.Add(verifiedTTL)
+	return true
+}
+
+// tokenPrefix marks strings as pocket-clone API tokens so they are easy to
+// recognise in configs and secret scanners.
+const tokenPrefix = "pc_"
+
+// GenerateToken returns a new random API token and the hash to store for it
+func GenerateToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of an API token. Tokens are long and
+// random, so a fast unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenDisplayPrefix returns the part of a token that is safe to show when
+// listing tokens
+func TokenDisplayPrefix(token string) string {
+	n := len(tokenPrefix) + 8
+	if len(token) < n {
+		return token
+	}
+	return token[:n]
+}
+
+// Middleware authenticates /api/* requests with an "Authorization: Bearer"
+// API token or HTTP Basic credentials and stores the user in the request
+// context. Routes listed in public may be called anonymously; an entry
+// ending in "/", such as "GET /api/assets/", covers every path below it.
+// Handlers for public routes must check UserFromContext themselves.
+// Everything outside /api/ is served without authentication.
+func Middleware(db *storage.SQLiteDB, public []string, next http.Handler) http.Handler {
+	verified := &verifiedCache{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") == "" {
+			if isPublic(public, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			unauthorized(w)
+			return
+		}
+
+		user := authenticate(db, verified, r)
+		if user == nil {
+			unauthorized(w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// authenticate returns the user identified by the request's Authorization
+// header, or nil if the credentials are missing or invalid
+func authenticate(db *storage.SQLiteDB, verified *verifiedCache, r *http.Request) *storage.User {
+	header := r.Header.Get("Authorization")
+	if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		user, err := db.GetUserByTokenHash(r.Context(), HashToken(strings.TrimSpace(token)))
+		if err != nil {
+			return nil
+		}
+		return user
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	user, hash, err := db.GetUserByUsername(r.Context(), username)
+	if err != nil || !verified.check(hash, password) {
+		return nil
+	}
+	return user
+}
+
+func isPublic(public []string, r *http.Request) bool {
+	route := r.Method + " " + r.URL.Path
+	for _, p := range public {
+		if p == route || (strings.HasSuffix(p, "/") && strings.HasPrefix(route, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="pocket-clone"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="pocket-clone"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerifiedCache(t *testing.T) {
+	hash, err := HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := HashPassword("password2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c verifiedCache
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"wrong password", hash, "wrong", false},
+		{"right password", hash, "password1", true},
+		{"cached", hash, "password1", true},
+		{"wrong password after a match", hash, "wrong", false},
+		{"changed hash", other, "password1", false},
+		{"new password", other, "password2", true},
+	}
+	for _, tt := range tests {
+		if got := c.check(tt.hash, tt.password); got != tt.want {
+			t.Errorf("%s: check = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Expired entries are checked against the hash again
+	for k := range c.expires {
+		c.expires[k] = time.Now().Add(-time.Second)
+	}
+	if !c.check(hash, "password1") {
+		t.Error("expired entry: check = false, want true")
+	}
+	if c.check(hash, "password2") {
+		t.Error("expired entry: wrong password accepted")
+	}
+}
+
+func TestVerifiedCacheIsBounded(t *testing.T) {
+	hash, err := HashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c verifiedCache
+	c.check(hash, "password1")
+	// Fill the cache with live entries for other hashes
+	for i := 0; len(c.expires) < maxVerified; i++ {
+		c.expires[verifiedKey(fmt.Sprint(i), "x")] = time.Now().Add(time.Minute)
+	}
+	if !c.check(hash, "password1") {
+		t.Error("check = false for a cached match")
+	}
+
+	delete(c.expires, verifiedKey(hash, "password1"))
+	c.expires[verifiedKey("full", "x")] = time.Now().Add(time.Minute)
+	if !c.check(hash, "password1") {
+		t.Error("check = false when the cache is full")
+	}
+	if len(c.expires) > maxVerified {
+		t.Errorf("cache holds %d entries, want at most %d", len(c.expires), maxVerified)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	public := []string{"POST /api/users", "GET /api/assets/"}
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{"POST", "/api/users", true},
+		{"GET", "/api/users", false},
+		{"POST", "/api/users/1", false},
+		{"GET", "/api/assets/abc", true},
+		{"GET", "/api/assets/", true},
+		{"HEAD", "/api/assets/abc", false},
+		{"GET", "/api/assets", false},
+		{"GET", "/api/articles", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := isPublic(public, r); got != tt.want {
+			t.Errorf("isPublic(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package canonical cleans article URLs and reduces them to keys that are
+// equal for the different addresses of the same page.
+package canonical
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters added for analytics that don't
+// change the page. Parameters starting with utm_ are dropped as well.
+var trackingParams = map[string]bool{
+	"fbclid":   true,
+	"gclid":    true,
+	"dclid":    true,
+	"msclkid":  true,
+	"yclid":    true,
+	"mc_cid":   true,
+	"mc_eid":   true,
+	"igshid":   true,
+	"_ga":      true,
+	"_hsenc":   true,
+	"_hsmi":    true,
+	"ref_src":  true,
+	"ref_url":  true,
+	"cmpid":    true,
+	"mkt_tok":  true,
+	"oly_anon": true,
+	"oly_enc":  true,
+	"vero_id":  true,
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// Clean removes what doesn't identify a page from a URL: tracking
+// parameters, the fragment and a default port. The host is lower-cased.
+func Clean(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (port == "80" && u.Scheme == "http") || (port == "443" && u.Scheme == "https") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		changed := false
+		for name := range query {
+			if isTrackingParam(name) {
+				query.Del(name)
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	u.ForceQuery = false
+}
+
+// Key returns a key that is equal for URLs of the same page. Besides what
+// Clean removes, it ignores http versus https, a www. prefix, a trailing
+// slash, the order of query parameters and the usual markers of AMP
+// versions. It returns "" for a URL that can't be parsed.
+func Key(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	Clean(u)
+
+	host := u.Hostname()
+	for _, prefix := range []string{"www.", "amp."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+
+	path := strings.TrimRight(u.EscapedPath(), "/")
+	path = strings.TrimSuffix(path, "/amp")
+	if strings.HasSuffix(path, ".amp.html") {
+		path = strings.TrimSuffix(path, ".amp.html") + ".html"
+	}
+	path = strings.TrimSuffix(path, ".amp")
+
+	query := u.Query()
+	query.Del("amp")
+	if strings.EqualFold(query.Get("outputType"), "amp") {
+		query.Del("outputType")
+	}
+
+	key := host + path
+	if len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key
+}
@@ -0,0 +1,102 @@
+package canonical
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"http://example.com:443/a", "http://example.com:443/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/a?", "https://example.com/a"},
+		{"https://example.com/a?utm_source=x&UTM_Medium=y&id=1&fbclid=z", "https://example.com/a?id=1"},
+		{"https://example.com/a?utm_source=x", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?b=2&a=1"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Clean(u)
+		if got := u.String(); got != tt.want {
+			t.Errorf("Clean(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		urls []string
+		want string
+	}{
+		{"scheme, www and trailing slash", []string{
+			"https://example.com/post",
+			"http://www.example.com/post/",
+			"HTTPS://WWW.EXAMPLE.COM/post#comments",
+			"https://example.com:443/post",
+			"  https://example.com/post  ",
+		}, "example.com/post"},
+		{"tracking parameters", []string{
+			"https://example.com/post?id=1&utm_source=feed",
+			"https://example.com/post?gclid=x&id=1",
+		}, "example.com/post?id=1"},
+		{"query order", []string{
+			"https://example.com/s?b=2&a=1",
+			"https://example.com/s?a=1&b=2",
+		}, "example.com/s?a=1&b=2"},
+		{"amp", []string{
+			"https://example.com/news/story",
+			"https://amp.example.com/news/story",
+			"https://example.com/news/story/amp",
+			"https://example.com/news/story/amp/",
+			"https://example.com/news/story.amp",
+			"https://example.com/news/story?amp",
+			"https://example.com/news/story?amp=1",
+			"https://example.com/news/story?outputType=AMP",
+		}, "example.com/news/story"},
+		{"amp html", []string{
+			"https://example.com/news/story.html",
+			"https://example.com/news/story.amp.html",
+		}, "example.com/news/story.html"},
+		{"port", []string{"http://example.com:8080/a"}, "example.com:8080/a"},
+		{"root", []string{"https://example.com", "https://example.com/"}, "example.com"},
+		{"escaped path", []string{"https://example.com/a%20b"}, "example.com/a%20b"},
+		{"no host", []string{"/relative/path", "example.com/post", "mailto:a@example.com"}, ""},
+		{"unparseable", []string{"https://exa mple.com/%zz"}, ""},
+	}
+	for _, tt := range tests {
+		for _, u := range tt.urls {
+			if got := Key(u); got != tt.want {
+				t.Errorf("%s: Key(%q) = %q, want %q", tt.name, u, got, tt.want)
+			}
+		}
+	}
+
+	// Different pages keep different keys
+	distinct := []string{
+		"https://example.com/post",
+		"https://example.com/post?id=2",
+		"https://example.com/other",
+		"https://blog.example.com/post",
+		"https://example.org/post",
+		"https://example.com/Post",
+	}
+	seen := map[string]string{}
+	for _, u := range distinct {
+		key := Key(u)
+		if prev, ok := seen[key]; ok {
+			t.Errorf("%s and %s have the same key %q", prev, u, key)
+		}
+		seen[key] = u
+	}
+}
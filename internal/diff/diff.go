@@ -0,0 +1,240 @@
+package diff
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Op is the kind of change a line represents
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of a diff
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits bounds the work spent on very different inputs. Past it the
+// middle of the inputs is reported as entirely replaced.
+const maxEdits = 2000
+
+// Lines returns the shortest sequence of line edits that turns a into b,
+// using Myers' algorithm
+func Lines(a, b []string) []Line {
+	// Common prefixes and suffixes are cheap to find and usually make up
+	// most of a revised document
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out []Line
+	for _, s := range a[:prefix] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k. trace keeps the
+	// part of v that each step started from, for walking back the path.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		snap := make([]int, 2*d+3)
+		copy(snap, v[offset-d-1:offset+d+2])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replace(a, b)
+	}
+
+	// Walk back from the end, collecting edits in reverse
+	var rev []Line
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			rev = append(rev, Line{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, Line{Insert, b[y-1]})
+			} else {
+				rev = append(rev, Line{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
+
+func replace(a, b []string) []Line {
+	out := make([]Line, 0, len(a)+len(b))
+	for _, s := range a {
+		out = append(out, Line{Delete, s})
+	}
+	for _, s := range b {
+		out = append(out, Line{Insert, s})
+	}
+	return out
+}
+
+// Unified renders a diff in unified format with the given number of
+// context lines around each change
+func Unified(lines []Line, from, to string, context int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+
+	// Line numbers in a and b at the start of each entry
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.Op != Insert {
+			aLine[i+1]++
+		}
+		if l.Op != Delete {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Grow the hunk until a run of unchanged lines is long enough to
+		// separate it from the next change
+		start := max(i-context, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Delete:
+				sb.WriteString("-")
+			case Insert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(l.Text)
+			sb.WriteString("\n")
+		}
+		i = end
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// HTML renders the whole of the new text as paragraphs, with removed lines
+// wrapped in <del> and added lines in <ins>
+func HTML(lines []Line) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		text := html.EscapeString(l.Text)
+		switch l.Op {
+		case Equal:
+			fmt.Fprintf(&sb, "<p>%s</p>\n", text)
+		case Delete:
+			fmt.Fprintf(&sb, "<p class=\"diff-del\"><del>%s</del></p>\n", text)
+		case Insert:
+			fmt.Fprintf(&sb, "<p class=\"diff-ins\"><ins>%s</ins></p>\n", text)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+// sides rebuilds the inputs of a diff
+func sides(lines []Line) (a, b []string) {
+	for _, l := range lines {
+		if l.Op != Insert {
+			a = append(a, l.Text)
+		}
+		if l.Op != Delete {
+			b = append(b, l.Text)
+		}
+	}
+	return a, b
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"equal", "a b c", "a b c"},
+		{"both empty", "", ""},
+		{"from empty", "", "a b"},
+		{"to empty", "a b", ""},
+		{"insert in middle", "a b d", "a b c d"},
+		{"delete at start", "x a b", "a b"},
+		{"replace", "a b c", "a x c"},
+		{"moved line", "a b c d", "b c d a"},
+		{"interleaved", "a b c a b b a", "c b a b a c"},
+		{"repeated lines", "a a a b", "b a a a"},
+		{"no common lines", "a b c", "x y z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			lines := Lines(a, b)
+
+			gotA, gotB := sides(lines)
+			if fmt.Sprint(gotA) != fmt.Sprint(a) || fmt.Sprint(gotB) != fmt.Sprint(b) {
+				t.Fatalf("diff %v rebuilds %v -> %v, want %v -> %v", lines, gotA, gotB, a, b)
+			}
+
+			edits := 0
+			for _, l := range lines {
+				if l.Op != Equal {
+					edits++
+				}
+			}
+			if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+				t.Errorf("%d edits, want the shortest %d: %v", edits, want, lines)
+			}
+		})
+	}
+}
+
+func TestLinesGivesUpOnLargeDiffs(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEdits; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	a = append(a, "end")
+	b = append(b, "end")
+
+	lines := Lines(a, b)
+	gotA, gotB := sides(lines)
+	if fmt.Sprint(gotA) != fmt.Sprint(a) || fmt.Sprint(gotB) != fmt.Sprint(b) {
+		t.Fatal("diff doesn't rebuild its inputs")
+	}
+	if last := lines[len(lines)-1]; last != (Line{Equal, "end"}) {
+		t.Errorf("last line = %+v, want the common suffix", last)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := strings.Fields("1 2 3 4 5 6 7 8 9 10 11 12")
+	b := strings.Fields("1 2 3 x 5 6 7 8 9 10 11 12 13")
+
+	tests := []struct {
+		context int
+		want    string
+	}{
+		{1, "--- a\n+++ b\n@@ -3,3 +3,3 @@\n 3\n-4\n+x\n 5\n@@ -12 +12,2 @@\n 12\n+13\n"},
+		{0, "--- a\n+++ b\n@@ -4 +4 @@\n-4\n+x\n@@ -12,0 +13 @@\n+13\n"},
+		{5, "--- a\n+++ b\n@@ -1,12 +1,13 @@\n 1\n 2\n 3\n-4\n+x\n 5\n 6\n 7\n 8\n 9\n 10\n 11\n 12\n+13\n"},
+	}
+	for _, tt := range tests {
+		if got := Unified(Lines(a, b), "a", "b", tt.context); got != tt.want {
+			t.Errorf("context %d:\n%s\nwant:\n%s", tt.context, got, tt.want)
+		}
+	}
+
+	if got := Unified(Lines(a, a), "a", "b", 3); got != "--- a\n+++ b\n" {
+		t.Errorf("no changes: %q", got)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	lines := []Line{{Equal, "same"}, {Delete, "<b>old</b>"}, {Insert, "new & improved"}}
+	want := "<p>same</p>\n" +
+		"<p class=\"diff-del\"><del>&lt;b&gt;old&lt;/b&gt;</del></p>\n" +
+		"<p class=\"diff-ins\"><ins>new &amp; improved</ins></p>\n"
+	if got := HTML(lines); got != want {
+		t.Errorf("HTML =\n%s\nwant:\n%s", got, want)
+	}
+}
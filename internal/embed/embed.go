@@ -0,0 +1,174 @@
+// Package embed turns article text into vectors for similarity search.
+package embed
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pocket-clone/internal/storage"
+)
+
+// Embedder computes vectors whose cosine similarity is high for texts
+// about the same things
+type Embedder interface {
+	// Model names the embedder and its settings. Vectors are only compared
+	// with vectors of the same model.
+	Model() string
+	Embed(text string) ([]float32, error)
+}
+
+// Hashing is an Embedder that needs no model files or network. It hashes
+// the words and word pairs of a text into a fixed number of dimensions,
+// weighing repeated words logarithmically and leaving out stop words, so
+// texts sharing distinctive vocabulary end up close.
+type Hashing struct {
+	Dims int
+}
+
+// NewHashing returns a hashing embedder with 512 dimensions
+func NewHashing() *Hashing {
+	return &Hashing{Dims: 512}
+}
+
+func (h *Hashing) Model() string {
+	return "hashing-v1-" + strconv.Itoa(h.Dims)
+}
+
+func (h *Hashing) Embed(text string) ([]float32, error) {
+	counts := make(map[string]int)
+	prev := ""
+	for _, word := range words(text) {
+		if stopWords[word] {
+			prev = ""
+			continue
+		}
+		counts[word]++
+		if prev != "" {
+			counts[prev+" "+word]++
+		}
+		prev = word
+	}
+
+	vector := make([]float32, h.Dims)
+	for feature, n := range counts {
+		weight := 1 + math.Log(float64(n))
+		if strings.Contains(feature, " ") {
+			weight /= 2
+		}
+
+		// The sign bit keeps features that share a dimension from only ever
+		// adding up
+		hash := fnv.New64a()
+		hash.Write([]byte(feature))
+		sum := hash.Sum64()
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(h.Dims)] += float32(weight)
+	}
+
+	normalize(vector)
+	return vector, nil
+}
+
+// words splits text into lower-case words of letters and digits, skipping
+// single characters
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	list := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) > 1 {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+func normalize(vector []float32) {
+	var sum float64
+	for _, f := range vector {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// stopWords are common English words that say nothing about what a text is
+// about
+var stopWords = make(map[string]bool)
+
+func init() {
+	for _, w := range strings.Fields(`
+		about above after again against all also am an and any are as at be
+		because been before being below between both but by can could did do
+		does doing down during each few for from further had has have having
+		he her here hers herself him himself his how if in into is it its
+		itself just me more most my myself no nor not now of off on once only
+		or other our ours ourselves out over own same she should so some such
+		than that the their theirs them themselves then there these they this
+		those through to too under until up very was we were what when where
+		which while who whom why will with would you your yours yourself
+		yourselves`) {
+		stopWords[w] = true
+	}
+}
+
+// articleText is the text an article is embedded from. The title counts
+// twice, as it says most about the subject.
+func articleText(a *storage.Article) string {
+	return a.Title + "\n" + a.Title + "\n" + a.Excerpt + "\n" + a.TextContent
+}
+
+// indexBatch is how many articles Index embeds per query
+const indexBatch = 100
+
+// Index computes and stores the vectors articles are missing, because they
+// were saved before vectors existed or the model changed. New and edited
+// articles are indexed one at a time with IndexArticle.
+func Index(ctx context.Context, db *storage.SQLiteDB, e Embedder) error {
+	model := e.Model()
+	for {
+		articles, err := db.ArticlesToEmbed(ctx, model, indexBatch)
+		if err != nil {
+			return err
+		}
+		if len(articles) == 0 {
+			return nil
+		}
+
+		for i := range articles {
+			vector, err := e.Embed(articleText(&articles[i]))
+			if err != nil {
+				return err
+			}
+			if err := db.SaveArticleVector(ctx, articles[i].ID, model, vector); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// IndexArticle computes and stores the vector of one ready article, after
+// its text was saved or changed
+func IndexArticle(ctx context.Context, db *storage.SQLiteDB, e Embedder, id int64) error {
+	article, err := db.ArticleToEmbed(ctx, id)
+	if err != nil {
+		return err
+	}
+	vector, err := e.Embed(articleText(article))
+	if err != nil {
+		return err
+	}
+	return db.SaveArticleVector(ctx, id, e.Model(), vector)
+}
@@ -0,0 +1,105 @@
+package embed
+
+import (
+	"math"
+	"testing"
+)
+
+// similarity is the cosine similarity of two vectors of equal length
+func similarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+func TestHashingIsDeterministic(t *testing.T) {
+	text := "Rust borrow checker and lifetimes explained. The borrow checker rejects dangling references."
+	a, err := NewHashing().Embed(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewHashing().Embed(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 512 {
+		t.Fatalf("len = %d, want 512", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("dimension %d differs: %v and %v", i, a[i], b[i])
+		}
+	}
+
+	// Vectors are unit length, so dot products are cosine similarities
+	var sum float64
+	for _, f := range a {
+		sum += float64(f) * float64(f)
+	}
+	if math.Abs(sum-1) > 1e-5 {
+		t.Errorf("squared norm = %v, want 1", sum)
+	}
+
+	if got := (&Hashing{Dims: 64}).Model(); got != "hashing-v1-64" {
+		t.Errorf("Model = %q", got)
+	}
+}
+
+func TestHashingSimilarity(t *testing.T) {
+	h := NewHashing()
+	embed := func(text string) []float32 {
+		v, err := h.Embed(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	rust := embed("The Rust borrow checker enforces ownership and lifetimes at compile time")
+	rust2 := embed("Understanding ownership, borrowing and lifetimes in Rust")
+	bread := embed("A sourdough bread recipe with a long cold fermentation and a crisp crust")
+
+	if got := similarity(rust, rust); math.Abs(got-1) > 1e-5 {
+		t.Errorf("similarity of a vector with itself = %v, want 1", got)
+	}
+	if related, unrelated := similarity(rust, rust2), similarity(rust, bread); related <= unrelated {
+		t.Errorf("related texts score %v, unrelated %v", related, unrelated)
+	}
+}
+
+func TestHashingEmptyText(t *testing.T) {
+	tests := []string{"", "   ", "the and of a", "!!! ... ???"}
+	for _, text := range tests {
+		v, err := NewHashing().Embed(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range v {
+			if f != 0 {
+				t.Errorf("Embed(%q)[%d] = %v, want a zero vector", text, i, f)
+				break
+			}
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := words("Go's net/http: 2 APIs, café & a 10x speed-up!")
+	want := []string{"go", "net", "http", "apis", "café", "10x", "speed", "up"}
+	if len(got) != len(want) {
+		t.Fatalf("words = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("words = %q, want %q", got, want)
+			break
+		}
+	}
+}
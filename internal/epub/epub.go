@@ -0,0 +1,322 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Book is an EPUB 3 book made of one chapter per article
+type Book struct {
+	// ID is a stable unique identifier, such as a URN
+	ID       string
+	Title    string
+	Author   string
+	Language string
+	Modified time.Time
+	Chapters []Chapter
+}
+
+type Chapter struct {
+	Title  string
+	Author string
+	// SourceURL is linked from the chapter heading and used to resolve
+	// relative links and images
+	SourceURL string
+	// Content is the article HTML
+	Content string
+}
+
+// ImageLoader returns the bytes and MIME type of an image referenced by an
+// article. src is the image source as written in the article; base is the
+// article's URL for resolving relative sources.
+type ImageLoader func(src string, base *url.URL) (data []byte, mediaType string, err error)
+
+// imageExtensions lists the image types EPUB readers are required to support
+var imageExtensions = map[string]string{
+	"image/jpeg":    "jpg",
+	"image/png":     "png",
+	"image/gif":     "gif",
+	"image/webp":    "webp",
+	"image/svg+xml": "svg",
+}
+
+type image struct {
+	ID        string
+	Href      string
+	MediaType string
+	data      []byte
+}
+
+type chapterFile struct {
+	Order     int
+	ID        string
+	Href      string
+	Title     string
+	Author    string
+	SourceURL string
+	Body      string
+}
+
+// Write renders the book as an EPUB file. Images are fetched with load and
+// embedded; images that can't be loaded are left out.
+func (b *Book) Write(w io.Writer, load ImageLoader) error {
+	lang := b.Language
+	if lang == "" {
+		lang = "und"
+	}
+	modified := b.Modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	var images []*image
+	bySrc := map[string]*image{}
+	embed := func(src string, base *url.URL) string {
+		if src == "" || load == nil {
+			return ""
+		}
+		key := src
+		if base != nil {
+			key = resolve(base, src)
+		}
+		if img, ok := bySrc[key]; ok {
+			if img == nil {
+				return ""
+			}
+			return img.Href
+		}
+
+		data, mediaType, err := load(src, base)
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		ext, ok := imageExtensions[strings.TrimSpace(mediaType)]
+		if err != nil || !ok || len(data) == 0 {
+			bySrc[key] = nil
+			return ""
+		}
+
+		img := &image{
+			ID:        fmt.Sprintf("img-%d", len(images)+1),
+			MediaType: strings.TrimSpace(mediaType),
+			data:      data,
+		}
+		img.Href = fmt.Sprintf("images/%s.%s", img.ID, ext)
+		images = append(images, img)
+		bySrc[key] = img
+		return img.Href
+	}
+
+	chapters := make([]chapterFile, len(b.Chapters))
+	for i, ch := range b.Chapters {
+		base, _ := url.Parse(ch.SourceURL)
+		body, err := toXHTML(ch.Content, base, func(src string) string {
+			return embed(src, base)
+		})
+		if err != nil {
+			return fmt.Errorf("chapter %d: %w", i+1, err)
+		}
+
+		title := ch.Title
+		if title == "" {
+			title = ch.SourceURL
+		}
+		sourceURL := ch.SourceURL
+		if !strings.HasPrefix(sourceURL, "http://") && !strings.HasPrefix(sourceURL, "https://") {
+			sourceURL = ""
+		}
+
+		chapters[i] = chapterFile{
+			Order:     i + 1,
+			ID:        fmt.Sprintf("chapter-%d", i+1),
+			Href:      fmt.Sprintf("chapter-%d.xhtml", i+1),
+			Title:     title,
+			Author:    ch.Author,
+			SourceURL: sourceURL,
+			Body:      body,
+		}
+	}
+
+	data := map[string]interface{}{
+		"Book":     b,
+		"Lang":     lang,
+		"Modified": modified.UTC().Format("2006-01-02T15:04:05Z"),
+		"Chapters": chapters,
+		"Images":   images,
+	}
+
+	zw := zip.NewWriter(w)
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	}
+
+	// The mimetype entry must come first and be stored uncompressed
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		tmpl *template.Template
+		data interface{}
+	}{
+		{"META-INF/container.xml", containerTmpl, nil},
+		{"OEBPS/content.opf", packageTmpl, data},
+		{"OEBPS/nav.xhtml", navTmpl, data},
+		{"OEBPS/toc.ncx", ncxTmpl, data},
+		{"OEBPS/style.css", styleTmpl, nil},
+	}
+	for _, f := range files {
+		fw, err := create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := f.tmpl.Execute(fw, f.data); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	for _, ch := range chapters {
+		fw, err := create("OEBPS/" + ch.Href)
+		if err != nil {
+			return err
+		}
+		err = chapterTmpl.Execute(fw, map[string]interface{}{"Chapter": ch, "Lang": lang})
+		if err != nil {
+			return fmt.Errorf("%s: %w", ch.Href, err)
+		}
+	}
+
+	for _, img := range images {
+		fw, err := create("OEBPS/" + img.Href)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(img.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// escapeXML escapes text for use in XML content and attribute values
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+var funcs = template.FuncMap{"xml": escapeXML}
+
+var containerTmpl = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var packageTmpl = template.Must(template.New("package").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{xml .Lang}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Book.ID}}</dc:identifier>
+    <dc:title>{{xml .Book.Title}}</dc:title>
+    <dc:language>{{xml .Lang}}</dc:language>
+{{- if .Book.Author}}
+    <dc:creator>{{xml .Book.Author}}</dc:creator>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.Href}}" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range .Images}}
+    <item id="{{.ID}}" href="{{.Href}}" media-type="{{.MediaType}}"/>
+{{- end}}
+  </manifest>
+  <spine toc="ncx">
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var navTmpl = template.Must(template.New("nav").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{xml .Lang}}" lang="{{xml .Lang}}">
+<head>
+  <title>{{xml .Book.Title}}</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+{{- range .Chapters}}
+      <li><a href="{{.Href}}">{{xml .Title}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var ncxTmpl = template.Must(template.New("ncx").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="{{xml .Book.ID}}"/>
+  </head>
+  <docTitle><text>{{xml .Book.Title}}</text></docTitle>
+  <navMap>
+{{- range .Chapters}}
+    <navPoint id="nav-{{.ID}}" playOrder="{{.Order}}">
+      <navLabel><text>{{xml .Title}}</text></navLabel>
+      <content src="{{.Href}}"/>
+    </navPoint>
+{{- end}}
+  </navMap>
+</ncx>
+`))
+
+var chapterTmpl = template.Must(template.New("chapter").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{xml .Lang}}" lang="{{xml .Lang}}">
+<head>
+  <title>{{xml .Chapter.Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <h1>{{xml .Chapter.Title}}</h1>
+{{- if or .Chapter.Author .Chapter.SourceURL}}
+  <p class="byline">
+    {{- if .Chapter.Author}}{{xml .Chapter.Author}}{{end}}
+    {{- if and .Chapter.Author .Chapter.SourceURL}} · {{end}}
+    {{- if .Chapter.SourceURL}}<a href="{{xml .Chapter.SourceURL}}">Original</a>{{end -}}
+  </p>
+{{- end}}
+  {{.Chapter.Body}}
+</body>
+</html>
+`))
+
+var styleTmpl = template.Must(template.New("style").Parse(`body { font-family: serif; line-height: 1.5; }
+h1 { font-size: 1.5em; margin-bottom: 0.25em; }
+.byline { color: #555; font-size: 0.9em; margin-top: 0; }
+img { max-width: 100%; height: auto; }
+pre { white-space: pre-wrap; font-size: 0.85em; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 2px solid #999; }
+`))
@@ -0,0 +1,218 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// png is a 1x1 transparent PNG
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\x00\x01\x00\x00\x05\x00\x01\r\n-\xb4\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func testLoader(src string, base *url.URL) ([]byte, string, error) {
+	if strings.Contains(src, "missing") {
+		return nil, "", errors.New("not found")
+	}
+	return png, "image/png", nil
+}
+
+func TestWriteArticle(t *testing.T) {
+	book := &Book{
+		ID:       "urn:pocket-clone:article:1",
+		Title:    "Tom & Jerry <live>",
+		Author:   "Ann",
+		Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Chapters: []Chapter{{
+			Title:     "Tom & Jerry <live>",
+			Author:    "Ann",
+			SourceURL: "https://example.com/posts/1",
+			Content: `<p>Hello<br>world &amp; friends</p><img src="/a.png"><img src="missing.png">` +
+				`<script>alert(1)</script><p id="x">one</p><p id="x">two</p><custom>kept text</custom>` +
+				`<a href="relative">link</a><a href="javascript:alert(1)">bad</a>`,
+		}},
+	}
+	files := checkEPUB(t, book)
+
+	ch := string(files["OEBPS/chapter-1.xhtml"])
+	for _, want := range []string{"kept text", `href="https://example.com/posts/relative"`, `src="images/img-1.png"`} {
+		if !strings.Contains(ch, want) {
+			t.Errorf("chapter is missing %q:\n%s", want, ch)
+		}
+	}
+	for _, unwanted := range []string{"<script", "javascript:", "missing.png", "<custom"} {
+		if strings.Contains(ch, unwanted) {
+			t.Errorf("chapter contains %q:\n%s", unwanted, ch)
+		}
+	}
+	if n := strings.Count(ch, `id="x"`); n != 1 {
+		t.Errorf("chapter has %d elements with id x, want 1", n)
+	}
+}
+
+func TestWriteTag(t *testing.T) {
+	book := &Book{
+		ID:    "urn:pocket-clone:user:1:tag:go",
+		Title: "go",
+		Chapters: []Chapter{
+			{Title: "First", SourceURL: "https://a.example/", Content: `<p>One</p><img src="https://img.example/shared.png">`},
+			{Title: "", SourceURL: "https://b.example/x", Content: `<table><tr><td colspan="2">Two</td></tr></table>`},
+			{Title: "Third", SourceURL: "https://c.example/", Content: `<img src="https://img.example/shared.png"><img src="other.png">`},
+		},
+	}
+	files := checkEPUB(t, book)
+
+	if _, ok := files["OEBPS/chapter-3.xhtml"]; !ok {
+		t.Fatal("book has no third chapter")
+	}
+	var images int
+	for name := range files {
+		if strings.HasPrefix(name, "OEBPS/images/") {
+			images++
+		}
+	}
+	// The shared image is stored once
+	if images != 2 {
+		t.Errorf("book has %d images, want 2", images)
+	}
+}
+
+type opfPackage struct {
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// checkEPUB writes a book and checks the structure EPUB readers rely on, as
+// epubcheck would. It returns the book's files by name.
+func checkEPUB(t *testing.T, book *Book) map[string][]byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := book.Write(&buf, testLoader); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		files[f.Name] = data
+	}
+
+	first := zr.File[0]
+	if first.Name != "mimetype" {
+		t.Fatalf("first entry is %q, want mimetype", first.Name)
+	}
+	if first.Method != zip.Store {
+		t.Errorf("mimetype is compressed with method %d", first.Method)
+	}
+	if got := string(files["mimetype"]); got != "application/epub+zip" {
+		t.Errorf("mimetype is %q", got)
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(files["META-INF/container.xml"], &container); err != nil {
+		t.Fatalf("container.xml: %v", err)
+	}
+	if len(container.Rootfiles) != 1 {
+		t.Fatalf("container.xml has %d rootfiles", len(container.Rootfiles))
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	opfData, ok := files[opfPath]
+	if !ok {
+		t.Fatalf("container.xml points at missing %s", opfPath)
+	}
+
+	var opf opfPackage
+	if err := xml.Unmarshal(opfData, &opf); err != nil {
+		t.Fatalf("%s: %v", opfPath, err)
+	}
+	dir := path.Dir(opfPath)
+
+	ids := map[string]string{}
+	inManifest := map[string]bool{opfPath: true, "mimetype": true, "META-INF/container.xml": true}
+	var nav bool
+	for _, item := range opf.Manifest {
+		name := path.Join(dir, item.Href)
+		if _, ok := files[name]; !ok {
+			t.Errorf("manifest item %s is not in the zip", name)
+		}
+		if _, dup := ids[item.ID]; dup {
+			t.Errorf("manifest id %s is used twice", item.ID)
+		}
+		ids[item.ID] = name
+		inManifest[name] = true
+		if item.Properties == "nav" {
+			nav = true
+		}
+
+		if item.MediaType == "application/xhtml+xml" {
+			checkWellFormed(t, name, files[name])
+		}
+	}
+	if !nav {
+		t.Error("manifest has no item with properties=\"nav\"")
+	}
+	for name := range files {
+		if !inManifest[name] {
+			t.Errorf("%s is in the zip but not in the manifest", name)
+		}
+	}
+
+	if len(opf.Spine) != len(book.Chapters) {
+		t.Errorf("spine has %d items, want %d", len(opf.Spine), len(book.Chapters))
+	}
+	for _, ref := range opf.Spine {
+		if _, ok := ids[ref.IDRef]; !ok {
+			t.Errorf("spine refers to unknown item %s", ref.IDRef)
+		}
+	}
+
+	return files
+}
+
+func checkWellFormed(t *testing.T, name string, data []byte) {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+	d.Entity = map[string]string{}
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Errorf("%s is not well-formed: %v", name, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package epub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pocket-clone/internal/fetch"
+)
+
+// MaxImageSize caps each embedded image so a single huge picture can't
+// bloat the book
+const MaxImageSize = 10 << 20
+
+// HTTPImageLoader downloads images from their original location with a
+// fetcher, which should accept any type and allow up to MaxImageSize.
+// Downloads stop when ctx is done.
+func HTTPImageLoader(ctx context.Context, fetcher *fetch.Fetcher) ImageLoader {
+	return func(src string, base *url.URL) ([]byte, string, error) {
+		src = resolve(base, src)
+		if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+			return nil, "", fmt.Errorf("unsupported image URL %q", src)
+		}
+
+		resp, err := fetcher.Get(ctx, src)
+		if err != nil {
+			return nil, "", fmt.Errorf("fetching %s: %w", src, err)
+		}
+		data := resp.Body
+
+		// Servers often mislabel images, so trust the bytes over the header
+		mediaType := http.DetectContentType(data)
+		if mediaType == "application/octet-stream" || strings.HasPrefix(mediaType, "text/") {
+			mediaType = resp.MediaType
+		}
+
+		return data, mediaType, nil
+	}
+}
@@ -0,0 +1,195 @@
+package epub
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedElements are kept when converting article HTML to XHTML. Other
+// elements are unwrapped so their text survives, except for those in
+// droppedElements, which are removed with their children.
+var allowedElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.Address: true, atom.Article: true, atom.Aside: true,
+	atom.B: true, atom.Bdi: true, atom.Bdo: true, atom.Blockquote: true, atom.Br: true,
+	atom.Caption: true, atom.Cite: true, atom.Code: true, atom.Col: true, atom.Colgroup: true,
+	atom.Dd: true, atom.Del: true, atom.Details: true, atom.Dfn: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Em: true, atom.Figcaption: true, atom.Figure: true,
+	atom.Footer: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true, atom.I: true,
+	atom.Img: true, atom.Ins: true, atom.Kbd: true, atom.Li: true, atom.Main: true,
+	atom.Mark: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Q: true,
+	atom.Rp: true, atom.Rt: true, atom.Ruby: true, atom.S: true, atom.Samp: true,
+	atom.Section: true, atom.Small: true, atom.Span: true, atom.Strong: true, atom.Sub: true,
+	atom.Summary: true, atom.Sup: true, atom.Table: true, atom.Tbody: true, atom.Td: true,
+	atom.Tfoot: true, atom.Th: true, atom.Thead: true, atom.Time: true, atom.Tr: true,
+	atom.U: true, atom.Ul: true, atom.Var: true, atom.Wbr: true,
+}
+
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Form: true, atom.Input: true,
+	atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Svg: true,
+	atom.Math: true, atom.Video: true, atom.Audio: true, atom.Source: true,
+	atom.Template: true, atom.Canvas: true,
+}
+
+// allowedAttrs lists the attributes kept on any element, plus per-element
+// extras
+var allowedAttrs = map[string]bool{
+	"title": true, "lang": true, "dir": true, "id": true,
+}
+
+var elementAttrs = map[atom.Atom]map[string]bool{
+	atom.A:        {"href": true},
+	atom.Img:      {"src": true, "alt": true},
+	atom.Td:       {"colspan": true, "rowspan": true},
+	atom.Th:       {"colspan": true, "rowspan": true},
+	atom.Time:     {"datetime": true},
+	atom.Ol:       {"start": true},
+	atom.Col:      {"span": true},
+	atom.Colgroup: {"span": true},
+}
+
+// toXHTML converts an HTML fragment into well-formed XHTML suitable for an
+// EPUB content document. Image sources are passed to embed as written,
+// which returns the path to use inside the book, or "" to drop the image.
+func toXHTML(fragment string, base *url.URL, embed func(src string) string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+
+	ids := map[string]bool{}
+	clean(body, base, embed, ids)
+
+	var sb strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&sb, c); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+func clean(n *html.Node, base *url.URL, embed func(string) string, ids map[string]bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.CommentNode, html.DoctypeNode:
+			n.RemoveChild(c)
+		case html.ElementNode:
+			switch {
+			case droppedElements[c.DataAtom]:
+				n.RemoveChild(c)
+			case !allowedElements[c.DataAtom]:
+				// Unwrap: clean the children, then splice them in place of c
+				clean(c, base, embed, ids)
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = gcNext
+				}
+				n.RemoveChild(c)
+			case c.DataAtom == atom.Img:
+				src := embed(attrValue(c, "src"))
+				if src == "" {
+					n.RemoveChild(c)
+					break
+				}
+				cleanAttrs(c, base, ids)
+				setAttr(c, "src", src)
+				if attrValue(c, "alt") == "" {
+					setAttr(c, "alt", "")
+				}
+			default:
+				cleanAttrs(c, base, ids)
+				clean(c, base, embed, ids)
+			}
+		}
+
+		c = next
+	}
+}
+
+func cleanAttrs(n *html.Node, base *url.URL, ids map[string]bool) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !(allowedAttrs[a.Key] || elementAttrs[n.DataAtom][a.Key]) {
+			continue
+		}
+
+		switch a.Key {
+		case "id":
+			// Duplicate IDs make the document invalid
+			if ids[a.Val] || !isXMLName(a.Val) {
+				continue
+			}
+			ids[a.Val] = true
+		case "href":
+			// Only links that still work outside the original page survive
+			a.Val = resolve(base, a.Val)
+			if !strings.HasPrefix(a.Val, "http://") && !strings.HasPrefix(a.Val, "https://") {
+				continue
+			}
+		}
+
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if base == nil || ref == "" {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// isXMLName reports whether s can be used as an XML ID
+func isXMLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 0x7f:
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"pocket-clone/internal/storage"
+)
+
+// Supported export formats
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+	FormatCSV  = "csv"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes a library export one article at a time
+type Writer interface {
+	// ContentType is the MIME type of the export
+	ContentType() string
+	// Extension is the file extension, without a dot
+	Extension() string
+	WriteArticle(a *storage.Article) error
+	// Close writes any trailer. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer for format that writes to w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatHTML:
+		return &netscapeWriter{w: w}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// jsonWriter writes a JSON array of articles, including their content
+type jsonWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *jsonWriter) ContentType() string { return "application/json" }
+func (j *jsonWriter) Extension() string   { return "json" }
+
+func (j *jsonWriter) WriteArticle(a *storage.Article) error {
+	sep := ",\n"
+	if !j.started {
+		sep = "[\n"
+		j.started = true
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.started {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// netscapeWriter writes the Netscape bookmark file format understood by
+// browsers and most read-later services. Unread articles are marked with
+// TOREAD and read ones carry LAST_VISIT.
+type netscapeWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (n *netscapeWriter) ContentType() string { return "text/html; charset=utf-8" }
+func (n *netscapeWriter) Extension() string   { return "html" }
+
+func (n *netscapeWriter) header() error {
+	if n.started {
+		return nil
+	}
+	n.started = true
+	_, err := io.WriteString(n.w, `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`)
+	return err
+}
+
+func (n *netscapeWriter) WriteArticle(a *storage.Article) error {
+	if err := n.header(); err != nil {
+		return err
+	}
+
+	var attrs strings.Builder
+	fmt.Fprintf(&attrs, ` HREF="%s" ADD_DATE="%d"`, html.EscapeString(a.URL), a.SavedAt.Unix())
+	if a.ReadAt != nil {
+		fmt.Fprintf(&attrs, ` LAST_VISIT="%d"`, a.ReadAt.Unix())
+	} else {
+		attrs.WriteString(` TOREAD="1"`)
+	}
+	if a.Archived {
+		attrs.WriteString(` ARCHIVED="1"`)
+	}
+	if len(a.Tags) > 0 {
+		fmt.Fprintf(&attrs, ` TAGS="%s"`, html.EscapeString(strings.Join(a.Tags, ",")))
+	}
+
+	title := a.Title
+	if title == "" {
+		title = a.URL
+	}
+
+	_, err := fmt.Fprintf(n.w, "    <DT><A%s>%s</A>\n", attrs.String(), html.EscapeString(title))
+	return err
+}
+
+func (n *netscapeWriter) Close() error {
+	if err := n.header(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(n.w, "</DL><p>\n")
+	return err
+}
+
+// csvWriter writes one row per article. Tags are separated by "|" as in
+// Pocket's CSV export.
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (c *csvWriter) ContentType() string { return "text/csv; charset=utf-8" }
+func (c *csvWriter) Extension() string   { return "csv" }
+
+func (c *csvWriter) header() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write([]string{"url", "title", "tags", "saved_at", "read_at", "archived", "favorite"})
+}
+
+func (c *csvWriter) WriteArticle(a *storage.Article) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+
+	readAt := ""
+	if a.ReadAt != nil {
+		readAt = a.ReadAt.UTC().Format(time.RFC3339)
+	}
+
+	return c.w.Write([]string{
+		a.URL,
+		a.Title,
+		strings.Join(a.Tags, "|"),
+		a.SavedAt.UTC().Format(time.RFC3339),
+		readAt,
+		strconv.FormatBool(a.Archived),
+		strconv.FormatBool(a.Favorite),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,290 @@
+// Package fetch downloads pages and resources from user-supplied URLs
+// without letting them reach the server's own network.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrUnsupportedScheme is returned for URLs that aren't http or https
+	ErrUnsupportedScheme = errors.New("only http and https URLs can be fetched")
+	// ErrBlockedAddress is returned when a host resolves to a loopback,
+	// private, link-local or otherwise internal address
+	ErrBlockedAddress = errors.New("address is not public")
+	// ErrTooLarge is returned for a body over the fetcher's MaxSize
+	ErrTooLarge = errors.New("response is too large")
+	// ErrUnsupportedType is returned for a media type the fetcher doesn't
+	// accept
+	ErrUnsupportedType = errors.New("unsupported content type")
+)
+
+// StatusError is returned for a response without a 2xx status
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status " + e.Status
+}
+
+// AllowPrivate turns off the address checks, for servers that are meant to
+// save pages from their own network. Set it before fetching anything.
+var AllowPrivate = false
+
+// maxRedirects is how many redirects are followed
+const maxRedirects = 10
+
+// transport is shared by every fetcher. Its dialer checks the address a host
+// resolved to right before connecting, which covers redirects and DNS
+// answers that change between lookups. Proxies from the environment are
+// ignored, as the proxy would make the connection instead.
+var transport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDial,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// reserved are ranges that aren't public but that netip reports as global
+// unicast: "this network", the shared address space carriers use behind
+// NAT and the NAT64 prefix set aside for local networks
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// IPv6 ranges that carry an IPv4 address, which a NAT64 gateway or a 6to4
+// relay may connect to in their place
+var (
+	nat64          = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour      = netip.MustParsePrefix("2002::/16")
+	ipv4Compatible = netip.MustParsePrefix("::/96")
+)
+
+// embeddedIPv4 returns the IPv4 address carried by a NAT64, 6to4 or
+// IPv4-compatible IPv6 address
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	if !addr.Is6() {
+		return netip.Addr{}, false
+	}
+	b := addr.As16()
+	switch {
+	case nat64.Contains(addr), ipv4Compatible.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+func allowed(addr netip.Addr) bool {
+	if AllowPrivate {
+		return true
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if v4, ok := embeddedIPv4(addr); ok {
+		return allowed(v4)
+	}
+	return true
+}
+
+// CheckURL reports whether a URL could be fetched, as far as can be told
+// without resolving its host: the scheme must be http or https, and a host
+// given as an IP address or as localhost must be public. Fetching checks
+// resolved addresses as well.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if AllowPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !allowed(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// Fetcher downloads response bodies of a bounded size and accepted media
+// types
+type Fetcher struct {
+	// MaxSize caps a response body
+	MaxSize int64
+	// Accept lists the media types that can be fetched. A type ending in
+	// "/", such as "image/", accepts all its subtypes. Empty accepts any
+	// type.
+	Accept []string
+
+	client *http.Client
+}
+
+// New returns a fetcher for bodies of up to maxSize bytes of the accepted
+// media types
+func New(maxSize int64, accept ...string) *Fetcher {
+	return &Fetcher{
+		MaxSize: maxSize,
+		Accept:  accept,
+		client: &http.Client{
+			Transport:     transport,
+			Timeout:       30 * time.Second,
+			CheckRedirect: checkRedirect,
+		},
+	}
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return CheckURL(req.URL.String())
+}
+
+// Response is a fetched body
+type Response struct {
+	Body []byte
+	// MediaType is the type without parameters, from the Content-Type
+	// header or sniffed from the body if the header has none or a generic
+	// one such as application/octet-stream
+	MediaType string
+	// ContentType is the Content-Type header as it was sent
+	ContentType string
+	// URL is the address after redirects
+	URL *url.URL
+}
+
+// Get downloads a URL, giving up when ctx is done. It fails with
+// ErrUnsupportedScheme, ErrBlockedAddress, a *StatusError, ErrTooLarge or
+// ErrUnsupportedType, or with the error of the request.
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*Response, error) {
+	if err := CheckURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if resp.ContentLength > f.MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > f.MaxSize {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrTooLarge, f.MaxSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || untyped[mediaType] {
+		mediaType = sniff(body)
+	}
+	if !f.accepts(mediaType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mediaType)
+	}
+
+	return &Response{
+		Body:        body,
+		MediaType:   mediaType,
+		ContentType: contentType,
+		URL:         resp.Request.URL,
+	}, nil
+}
+
+// untyped are media types servers send for files they don't know the type
+// of, which are sniffed instead
+var untyped = map[string]bool{
+	"application/octet-stream":   true,
+	"binary/octet-stream":        true,
+	"application/unknown":        true,
+	"application/download":       true,
+	"application/x-download":     true,
+	"application/force-download": true,
+}
+
+// sniff returns the media type of a body from its first bytes
+func sniff(body []byte) string {
+	// A PDF may have junk before its header, which readers skip; the
+	// standard sniffer only looks at the very start
+	if bytes.Contains(body[:min(len(body), 1024)], []byte("%PDF-")) {
+		return "application/pdf"
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(body))
+	return mediaType
+}
+
+func (f *Fetcher) accepts(mediaType string) bool {
+	if len(f.Accept) == 0 {
+		return true
+	}
+	for _, accept := range f.Accept {
+		if mediaType == accept || (strings.HasSuffix(accept, "/") && strings.HasPrefix(mediaType, accept)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetMediaType(t *testing.T) {
+	AllowPrivate = true
+	t.Cleanup(func() { AllowPrivate = false })
+
+	pdf := "%PDF-1.7\n1 0 obj\n<<>>\nendobj\n"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		wantErr     error
+	}{
+		{"pdf", "application/pdf", pdf, "application/pdf", nil},
+		{"pdf as octet-stream", "application/octet-stream", pdf, "application/pdf", nil},
+		{"pdf as binary/octet-stream", "binary/octet-stream", pdf, "application/pdf", nil},
+		{"pdf after junk", "binary/octet-stream", "\r\n\x00junk" + pdf, "application/pdf", nil},
+		{"pdf without a type", "", pdf, "application/pdf", nil},
+		{"html with charset", "text/html; charset=utf-8", "<p>hi</p>", "text/html", nil},
+		{"html as octet-stream", "application/octet-stream", "<!DOCTYPE html><p>hi</p>", "text/html", nil},
+		{"binary", "binary/octet-stream", "\x00\x01\x02\x03", "", ErrUnsupportedType},
+		{"image", "image/png", "\x89PNG\r\n\x1a\n", "", ErrUnsupportedType},
+		{"pdf labelled as an image", "image/png", pdf, "", ErrUnsupportedType},
+	}
+
+	f := New(1<<20, "text/html", "application/pdf")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = []string{tt.contentType}
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			resp, err := f.Get(context.Background(), srv.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.MediaType != tt.want {
+				t.Errorf("MediaType = %q, want %q", resp.MediaType, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::10.0.0.1", false},
+		{"64:ff9b::169.254.169.254", false},
+		{"64:ff9b::93.184.216.34", true},
+		{"64:ff9b:1::5db8:d822", false},
+		{"2002:7f00:1::", false},
+		{"2002:a9fe:a9fe::1", false},
+		{"2002:c0a8:101::1", false},
+		{"2002:5db8:d822::1", true},
+		{"::127.0.0.1", false},
+		{"::10.0.0.1", false},
+		{"::93.184.216.34", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://example.com/a", nil},
+		{"http://example.com:8080/a", nil},
+		{"http://93.184.216.34/", nil},
+		{"ftp://example.com/a", ErrUnsupportedScheme},
+		{"file:///etc/passwd", ErrUnsupportedScheme},
+		{"gopher://example.com/", ErrUnsupportedScheme},
+		{"javascript:alert(1)", ErrUnsupportedScheme},
+		{"example.com/a", ErrUnsupportedScheme},
+		{"http://localhost/", ErrBlockedAddress},
+		{"http://LOCALHOST:8080/", ErrBlockedAddress},
+		{"http://api.localhost/", ErrBlockedAddress},
+		{"http://127.0.0.1/", ErrBlockedAddress},
+		{"http://10.1.2.3:8080/", ErrBlockedAddress},
+		{"http://169.254.169.254/latest/meta-data/", ErrBlockedAddress},
+		{"http://0.0.0.0/", ErrBlockedAddress},
+		{"http://100.64.1.1/", ErrBlockedAddress},
+		{"http://[::1]/", ErrBlockedAddress},
+		{"http://[fe80::1]/", ErrBlockedAddress},
+		{"http://[::ffff:127.0.0.1]/", ErrBlockedAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := CheckURL(tt.url); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckURL(%q) = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	if err := checkDial("tcp", "127.0.0.1:80", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("checkDial(127.0.0.1) = %v, want ErrBlockedAddress", err)
+	}
+	if err := checkDial("tcp6", "[::1]:443", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("checkDial(::1) = %v, want ErrBlockedAddress", err)
+	}
+	for _, address := range []string{"[64:ff9b::7f00:1]:80", "[2002:7f00:1::]:80", "[::127.0.0.1]:80"} {
+		if err := checkDial("tcp6", address, nil); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("checkDial(%s) = %v, want ErrBlockedAddress", address, err)
+		}
+	}
+	if err := checkDial("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("checkDial(93.184.216.34) = %v", err)
+	}
+}
+
+// testFetcher returns a fetcher that connects to srv whatever host a URL
+// names, so that the address checks apply to public-looking URLs served
+// locally
+func testFetcher(srv *httptest.Server, maxSize int64) *Fetcher {
+	f := New(maxSize)
+	f.client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}
+	return f
+}
+
+func TestGetBlocksRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("ok"))
+		case "/public":
+			http.Redirect(w, r, "http://example.com/ok", http.StatusFound)
+		default:
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	f := testFetcher(srv, 1<<20)
+
+	if _, err := f.Get(context.Background(), "http://example.com/public"); err != nil {
+		t.Fatalf("redirect to a public host: %v", err)
+	}
+
+	targets := []string{
+		"http://127.0.0.1/",
+		"http://" + srv.Listener.Addr().String() + "/ok",
+		"http://localhost/",
+		"http://10.0.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"file:///etc/passwd",
+	}
+	for _, target := range targets {
+		t.Run(target, func(t *testing.T) {
+			_, err := f.Get(context.Background(), "http://example.com/?to="+url.QueryEscape(target))
+			if err == nil {
+				t.Fatal("redirect was followed")
+			}
+			if !errors.Is(err, ErrBlockedAddress) && !errors.Is(err, ErrUnsupportedScheme) {
+				t.Errorf("err = %v, want ErrBlockedAddress or ErrUnsupportedScheme", err)
+			}
+		})
+	}
+}
+
+func TestGetBlocksLocalServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the server")
+	}))
+	defer srv.Close()
+
+	if _, err := New(1<<20).Get(context.Background(), srv.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("err = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestGetSizeLimit(t *testing.T) {
+	const maxSize = 1024
+	tests := []struct {
+		name    string
+		size    int
+		chunked bool
+		wantErr error
+	}{
+		{"at the limit", maxSize, false, nil},
+		{"over the limit", maxSize + 1, false, ErrTooLarge},
+		{"chunked at the limit", maxSize, true, nil},
+		{"chunked over the limit", 10 * maxSize, true, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				body := strings.Repeat("a", tt.size)
+				if tt.chunked {
+					// Without a Content-Length the limit applies while reading
+					w.Write([]byte(body[:1]))
+					w.(http.Flusher).Flush()
+					w.Write([]byte(body[1:]))
+					return
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(tt.size))
+				w.Write([]byte(body))
+			}))
+			defer srv.Close()
+
+			resp, err := testFetcher(srv, maxSize).Get(context.Background(), "http://example.com/")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Body) != tt.size {
+				t.Errorf("body is %d bytes, want %d", len(resp.Body), tt.size)
+			}
+		})
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(code)
+				w.Write([]byte("<p>error page</p>"))
+			}))
+			defer srv.Close()
+
+			_, err := testFetcher(srv, 1<<20).Get(context.Background(), "http://example.com/")
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("err = %v, want a *StatusError", err)
+			}
+			if statusErr.StatusCode != code {
+				t.Errorf("StatusCode = %d, want %d", statusErr.StatusCode, code)
+			}
+		})
+	}
+}
@@ -2,28 +2,66 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"pocket-clone/internal/auth"
+	"pocket-clone/internal/embed"
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/ingest"
 	"pocket-clone/internal/parser"
 	"pocket-clone/internal/storage"
 )
 
 type Handler struct {
-	db *storage.SQLiteDB
+	db    *storage.SQLiteDB
+	queue *ingest.Queue
+	// embedder computes the vectors of similar-article and semantic search
+	embedder embed.Embedder
 }
 
-func New(db *storage.SQLiteDB) *Handler {
-	return &Handler{db: db}
+func New(db *storage.SQLiteDB, queue *ingest.Queue) *Handler {
+	return &Handler{db: db, queue: queue, embedder: queue.Embedder}
+}
+
+// userID returns the ID of the authenticated user. Routes behind
+// auth.Middleware always have one.
+func userID(r *http.Request) int64 {
+	return auth.UserFromContext(r.Context()).ID
 }
 
 type CreateArticleRequest struct {
 	URL string `json:"url"`
 }
 
+// UpdateArticleRequest changes an article. MarkRead is kept for older
+// clients: true marks the article read and false marks it unread. ReadState
+// takes precedence when both are given.
 type UpdateArticleRequest struct {
-	Archived *bool `json:"archived,omitempty"`
-	MarkRead *bool `json:"mark_read,omitempty"`
+	Archived  *bool   `json:"archived,omitempty"`
+	MarkRead  *bool   `json:"mark_read,omitempty"`
+	ReadState *string `json:"read_state,omitempty"`
+	Favorite  *bool   `json:"favorite,omitempty"`
+	Title     *string `json:"title,omitempty"`
+	Content   *string `json:"content,omitempty"`
+}
+
+// ArticlePage is one page of an article list or search. NextCursor is
+// passed as ?cursor= to get the next page and is left out on the last one.
+// Total counts every matching article and, like the facets of a search, is
+// only sent with the first page.
+type ArticlePage struct {
+	Articles   []storage.Article `json:"articles"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Total      *int              `json:"total,omitempty"`
+	Facets     *storage.Facets   `json:"facets,omitempty"`
 }
 
 type AddTagRequest struct {
@@ -42,23 +80,56 @@ func (h *Handler) CreateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse article content
-	article, err := parser.Parse(req.URL)
+	articleURL, err := parser.NormalizeURL(req.URL)
 	if err != nil {
-		http.Error(w, "Failed to parse article: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, "Invalid URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Refuse addresses that can't be fetched now rather than saving an
+	// article that is bound to fail
+	if err := fetch.CheckURL(articleURL); err != nil {
+		http.Error(w, "Invalid URL: "+err.Error(), fetchErrorStatus(err))
 		return
 	}
 
-	// Save to database
-	id, err := h.db.CreateArticle(article)
-	if err != nil {
-		http.Error(w, "Failed to save article: "+err.Error(), http.StatusInternalServerError)
+	// Saving a page again returns the article already saved
+	existing, err := h.db.FindArticleByURL(r.Context(), userID(r), articleURL)
+	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing)
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Failed to save article", http.StatusInternalServerError)
 		return
 	}
 
+	// Save a pending row; the ingest queue fetches and parses it
+	article := &storage.Article{
+		URL:     articleURL,
+		Status:  storage.StatusPending,
+		SavedAt: time.Now(),
+	}
+	id, err := h.db.CreateArticle(r.Context(), userID(r), article)
+	if err != nil {
+		// Lost a race with a concurrent save of the same URL
+		if existing, findErr := h.db.FindArticleByURL(r.Context(), userID(r), articleURL); findErr == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(existing)
+			return
+		}
+		http.Error(w, "Failed to save article", http.StatusInternalServerError)
+		return
+	}
 	article.ID = id
+
+	// The article is saved either way: one that doesn't fit in the queue is
+	// picked up by the sweep, and one saved while the server stops by
+	// EnqueuePending on the next start
+	h.queue.Enqueue(article.ID, article.URL)
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(article)
 }
 
@@ -70,11 +141,23 @@ func (h *Handler) GetArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := h.db.GetArticle(id)
+	article, err := h.db.GetArticle(r.Context(), userID(r), id)
 	if err != nil {
+		// An article found to be a duplicate after it was saved lives on
+		// as the earlier save of the page
+		if existing, err := h.db.MergedInto(r.Context(), userID(r), id); err == nil {
+			http.Redirect(w, r, "/api/articles/"+strconv.FormatInt(existing, 10), http.StatusPermanentRedirect)
+			return
+		}
 		http.Error(w, "Article not found", http.StatusNotFound)
 		return
 	}
+	// Articles saved before content was sanitized are cleaned as they are
+	// read
+	if article.Content, err = parser.Sanitize(article.Content, nil); err != nil {
+		http.Error(w, "Failed to get article", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(article)
@@ -83,11 +166,16 @@ func (h *Handler) GetArticle(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ListArticles(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 
-	// Parse filters
-	var archived *bool
-	if a := query.Get("archived"); a != "" {
-		val := a == "true"
-		archived = &val
+	filter, err := parseFilter(query)
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sort := query.Get("sort")
+	if sort != "" && !storage.IsSort(sort) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
 	}
 
 	limit := 50
@@ -97,33 +185,179 @@ func (h *Handler) ListArticles(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	offset := 0
-	if o := query.Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
+	opts := storage.ListOptions{
+		Filter: filter,
+		Sort:   sort,
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+	}
+	articles, next, err := h.db.ListArticles(r.Context(), userID(r), opts)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
 		}
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
 	}
 
-	// Check for tag filter
-	if tag := query.Get("tag"); tag != "" {
-		articles, err := h.db.GetArticlesByTag(tag, limit, offset)
+	page := ArticlePage{Articles: articles, NextCursor: next}
+	if opts.Cursor == "" {
+		total, err := h.db.CountArticles(r.Context(), userID(r), filter)
 		if err != nil {
 			http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(articles)
-		return
+		page.Total = &total
 	}
 
-	articles, err := h.db.ListArticles(archived, limit, offset)
-	if err != nil {
-		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseFilter reads the article filter shared by listing and search from
+// query parameters. tag may be repeated and requires every tag; any_tag and
+// not_tag take comma-separated lists.
+func parseFilter(query url.Values) (storage.Filter, error) {
+	var f storage.Filter
+
+	if a := query.Get("archived"); a != "" {
+		val := a == "true"
+		f.Archived = &val
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(articles)
+	if v := query.Get("favorite"); v != "" {
+		val := v == "true"
+		f.Favorite = &val
+	}
+
+	f.ReadState = query.Get("read_state")
+	if f.ReadState != "" && !storage.IsReadState(f.ReadState) {
+		return f, errors.New("read_state must be unread, in_progress or read")
+	}
+
+	f.AllTags = query["tag"]
+	f.AnyTags = splitList(query.Get("any_tag"))
+	f.NotTags = splitList(query.Get("not_tag"))
+	f.Domain = query.Get("domain")
+	f.Author = query.Get("author")
+
+	var err error
+	if f.SavedAfter, err = parseDate(query.Get("saved_after")); err != nil {
+		return f, errors.New("saved_after must be a date or an RFC 3339 time")
+	}
+	if f.SavedBefore, err = parseDate(query.Get("saved_before")); err != nil {
+		return f, errors.New("saved_before must be a date or an RFC 3339 time")
+	}
+
+	if f.MinWords, err = parseCount(query.Get("min_words")); err != nil {
+		return f, errors.New("min_words must be a non-negative number")
+	}
+	if f.MaxWords, err = parseCount(query.Get("max_words")); err != nil {
+		return f, errors.New("max_words must be a non-negative number")
+	}
+
+	return f, nil
+}
+
+// splitList splits a comma-separated parameter, dropping empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseDate accepts a date (YYYY-MM-DD, taken as midnight UTC) or an RFC
+// 3339 time. An empty string is the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseCount parses a non-negative number. An empty string is zero.
+func parseCount(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 0 {
+		err = errors.New("negative count")
+	}
+	return n, err
+}
+
+// parseRanking reads search ranking overrides from query parameters, for
+// tuning: weights=title:10,author:3 sets column weights, recency_boost and
+// half_life_days the boost for recent articles and archived_weight the
+// factor for archived ones. It returns nil without any overrides.
+func parseRanking(params url.Values) (*storage.Ranking, error) {
+	if params.Get("weights") == "" && params.Get("recency_boost") == "" &&
+		params.Get("half_life_days") == "" && params.Get("archived_weight") == "" {
+		return nil, nil
+	}
+	ranking := storage.DefaultRanking
+
+	for _, item := range splitList(params.Get("weights")) {
+		column, value, _ := strings.Cut(item, ":")
+		weight, err := parseWeight(value)
+		if err != nil {
+			return nil, fmt.Errorf("weight of %s: %w", column, err)
+		}
+		switch column {
+		case "title":
+			ranking.Weights.Title = weight
+		case "text":
+			ranking.Weights.Text = weight
+		case "author":
+			ranking.Weights.Author = weight
+		case "excerpt":
+			ranking.Weights.Excerpt = weight
+		case "domain":
+			ranking.Weights.Domain = weight
+		case "highlight":
+			ranking.Weights.Highlight = weight
+		default:
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+
+	var err error
+	if v := params.Get("recency_boost"); v != "" {
+		if ranking.RecencyBoost, err = parseWeight(v); err != nil {
+			return nil, fmt.Errorf("recency_boost: %w", err)
+		}
+	}
+	if v := params.Get("half_life_days"); v != "" {
+		days, err := parseWeight(v)
+		if err != nil || days == 0 {
+			return nil, errors.New("half_life_days must be a positive number")
+		}
+		ranking.RecencyHalfLife = time.Duration(days * float64(24*time.Hour))
+	}
+	if v := params.Get("archived_weight"); v != "" {
+		if ranking.ArchivedWeight, err = parseWeight(v); err != nil {
+			return nil, fmt.Errorf("archived_weight: %w", err)
+		}
+	}
+	return &ranking, nil
+}
+
+// parseWeight parses a finite, non-negative number
+func parseWeight(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errors.New("not a non-negative number")
+	}
+	return f, nil
 }
 
 func (h *Handler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
@@ -140,11 +374,58 @@ func (h *Handler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.UpdateArticle(id, req.Archived, req.MarkRead); err != nil {
+	update := storage.ArticleUpdate{
+		Archived:  req.Archived,
+		ReadState: req.ReadState,
+		Favorite:  req.Favorite,
+		Title:     req.Title,
+		Content:   req.Content,
+	}
+	if req.ReadState != nil {
+		if !storage.IsReadState(*req.ReadState) {
+			http.Error(w, "Invalid read_state", http.StatusBadRequest)
+			return
+		}
+	} else if req.MarkRead != nil {
+		state := storage.ReadStateUnread
+		if *req.MarkRead {
+			state = storage.ReadStateRead
+		}
+		update.ReadState = &state
+	}
+	if req.Content != nil {
+		// Edited content is shown like fetched content, so it is held to the
+		// same rules. Relative links, such as archived images, are kept.
+		content, err := parser.Sanitize(*req.Content, nil)
+		if err != nil {
+			http.Error(w, "Invalid content: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		text, err := parser.TextFromHTML(content)
+		if err != nil {
+			http.Error(w, "Invalid content: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		update.Content = &content
+		update.TextContent = &text
+	}
+
+	if err := h.db.UpdateArticle(r.Context(), userID(r), id, update); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to update article", http.StatusInternalServerError)
 		return
 	}
 
+	// Edits drop the article's vector, so compute it again
+	if update.Title != nil || update.Content != nil {
+		if err := embed.IndexArticle(r.Context(), h.db, h.embedder, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("articles: article %d: failed to index: %v", id, err)
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -156,7 +437,11 @@ func (h *Handler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.DeleteArticle(id); err != nil {
+	if err := h.db.DeleteArticle(r.Context(), userID(r), id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to delete article", http.StatusInternalServerError)
 		return
 	}
@@ -164,32 +449,89 @@ func (h *Handler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Search finds articles matching ?q=; see storage.ParseSearchQuery for the
+// query syntax
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
+	params := r.URL.Query()
+	switch params.Get("mode") {
+	case "", "keyword":
+	case "semantic":
+		h.semanticSearch(w, r)
+		return
+	default:
+		http.Error(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	query := storage.ParseSearchQuery(params.Get("q"))
+	if query.IsEmpty() {
 		http.Error(w, "Search query is required", http.StatusBadRequest)
 		return
 	}
 
+	filter, err := parseFilter(params)
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sort := params.Get("sort")
+	if sort != "" && sort != storage.SortRelevance && !storage.IsSort(sort) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	ranking, err := parseRanking(params)
+	if err != nil {
+		http.Error(w, "Invalid ranking: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limit := 20
-	if l := r.URL.Query().Get("limit"); l != "" {
+	if l := params.Get("limit"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 50 {
 			limit = parsed
 		}
 	}
 
-	articles, err := h.db.Search(query, limit)
+	opts := storage.ListOptions{
+		Filter:  filter,
+		Sort:    sort,
+		Limit:   limit,
+		Cursor:  params.Get("cursor"),
+		Ranking: ranking,
+	}
+	articles, next, err := h.db.Search(r.Context(), userID(r), query, opts)
 	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Search failed", http.StatusInternalServerError)
 		return
 	}
 
+	page := ArticlePage{Articles: articles, NextCursor: next}
+	if opts.Cursor == "" {
+		total, err := h.db.CountSearch(r.Context(), userID(r), query, filter)
+		if err != nil {
+			http.Error(w, "Search failed", http.StatusInternalServerError)
+			return
+		}
+		page.Total = &total
+
+		if page.Facets, err = h.db.SearchFacets(r.Context(), userID(r), query, filter); err != nil {
+			http.Error(w, "Search failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(articles)
+	json.NewEncoder(w).Encode(page)
 }
 
 func (h *Handler) ListTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := h.db.GetAllTags()
+	tags, err := h.db.GetAllTags(r.Context(), userID(r))
 	if err != nil {
 		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
 		return
@@ -218,13 +560,17 @@ func (h *Handler) AddTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tagID, err := h.db.CreateTag(req.Tag)
+	tagID, err := h.db.CreateTag(r.Context(), userID(r), req.Tag)
 	if err != nil {
 		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.db.AddTagToArticle(articleID, tagID); err != nil {
+	if err := h.db.AddTagToArticle(r.Context(), userID(r), articleID, tagID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to add tag to article", http.StatusInternalServerError)
 		return
 	}
@@ -247,7 +593,7 @@ func (h *Handler) RemoveTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get tag ID
-	tags, err := h.db.GetAllTags()
+	tags, err := h.db.GetAllTags(r.Context(), userID(r))
 	if err != nil {
 		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
 		return
@@ -266,7 +612,7 @@ func (h *Handler) RemoveTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.RemoveTagFromArticle(articleID, tagID); err != nil {
+	if err := h.db.RemoveTagFromArticle(r.Context(), userID(r), articleID, tagID); err != nil {
 		http.Error(w, "Failed to remove tag", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"pocket-clone/internal/auth"
+	"pocket-clone/internal/ingest"
+	"pocket-clone/internal/storage"
+)
+
+func TestParseRanking(t *testing.T) {
+	def := storage.DefaultRanking
+	with := func(change func(*storage.Ranking)) *storage.Ranking {
+		r := def
+		change(&r)
+		return &r
+	}
+
+	tests := []struct {
+		query   string
+		want    *storage.Ranking
+		wantErr bool
+	}{
+		{query: "", want: nil},
+		{query: "q=go&sort=relevance", want: nil},
+		{query: "weights=title:3", want: with(func(r *storage.Ranking) { r.Weights.Title = 3 })},
+		{query: "weights=title:3,%20author:0,text:1.5,excerpt:4,domain:0.25,highlight:2", want: with(func(r *storage.Ranking) {
+			r.Weights = storage.ColumnWeights{Title: 3, Text: 1.5, Author: 0, Excerpt: 4, Domain: 0.25, Highlight: 2}
+		})},
+		{query: "weights=", want: nil},
+		{query: "recency_boost=0", want: with(func(r *storage.Ranking) { r.RecencyBoost = 0 })},
+		{query: "recency_boost=2&half_life_days=7", want: with(func(r *storage.Ranking) {
+			r.RecencyBoost = 2
+			r.RecencyHalfLife = 7 * 24 * time.Hour
+		})},
+		{query: "half_life_days=0.5", want: with(func(r *storage.Ranking) { r.RecencyHalfLife = 12 * time.Hour })},
+		{query: "archived_weight=0.1", want: with(func(r *storage.Ranking) { r.ArchivedWeight = 0.1 })},
+		{query: "weights=body:2", wantErr: true},
+		{query: "weights=title", wantErr: true},
+		{query: "weights=title:-1", wantErr: true},
+		{query: "weights=title:NaN", wantErr: true},
+		{query: "weights=title:Inf", wantErr: true},
+		{query: "weights=title:x", wantErr: true},
+		{query: "recency_boost=-0.5", wantErr: true},
+		{query: "recency_boost=lots", wantErr: true},
+		{query: "half_life_days=0", wantErr: true},
+		{query: "half_life_days=-3", wantErr: true},
+		{query: "half_life_days=+Inf", wantErr: true},
+		{query: "archived_weight=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseRanking(params)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRanking = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseRanking = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Overrides don't change the defaults
+	if storage.DefaultRanking != def {
+		t.Error("parseRanking changed DefaultRanking")
+	}
+}
+
+func TestCreateArticleWithoutRoomInQueue(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewSQLiteDB(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	user, err := db.CreateUser(ctx, "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without workers nothing leaves the queue, so it fills up
+	queue := ingest.New(db, 1)
+	for id := int64(1_000_000); id < 1_002_000; id++ {
+		queue.Enqueue(id, "https://example.com/backlog")
+	}
+	h := New(db, queue)
+
+	save := func(articleURL string) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/articles", strings.NewReader(`{"url": "`+articleURL+`"}`))
+		r = r.WithContext(auth.WithUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		h.CreateArticle(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("POST %s: status = %d, want %d", articleURL, w.Code, http.StatusAccepted)
+		}
+		var article storage.Article
+		if err := json.NewDecoder(w.Body).Decode(&article); err != nil {
+			t.Fatal(err)
+		}
+		if article.Status != storage.StatusPending {
+			t.Errorf("POST %s: status %q, want %q", articleURL, article.Status, storage.StatusPending)
+		}
+		// The sweep or the next start fetches what is left pending
+		stored, err := db.GetArticle(ctx, user.ID, article.ID)
+		if err != nil {
+			t.Fatalf("POST %s: article isn't saved: %v", articleURL, err)
+		}
+		if stored.Status != storage.StatusPending {
+			t.Errorf("POST %s: saved with status %q, want %q", articleURL, stored.Status, storage.StatusPending)
+		}
+	}
+
+	save("https://example.com/full")
+	queue.Stop()
+	save("https://example.com/stopped")
+}
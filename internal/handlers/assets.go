@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"pocket-clone/internal/assets"
+)
+
+// GetAsset serves an archived image. It is a public route; see
+// server.publicRoutes. Assets are addressed by the hash of their content,
+// so responses never change and can be cached forever.
+func (h *Handler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	hash, ok := assets.HashFromPath(assets.Path(r.PathValue("hash")))
+	if !ok {
+		http.Error(w, "Invalid asset hash", http.StatusBadRequest)
+		return
+	}
+
+	asset, err := h.db.GetAsset(r.Context(), hash)
+	if err != nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", asset.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(asset.Data)))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	// SVGs can carry scripts; never let an asset run in our origin
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(asset.Data)
+}
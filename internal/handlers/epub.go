@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pocket-clone/internal/assets"
+	"pocket-clone/internal/epub"
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/storage"
+)
+
+// maxEPUBArticles caps how many articles go into a tag collection
+const maxEPUBArticles = 200
+
+// epubTimeout bounds writing a book, which isn't limited by the server's
+// write timeout. Images not loaded by then are left out.
+const epubTimeout = 5 * time.Minute
+
+// imageFetcher downloads images that were never archived
+var imageFetcher = fetch.New(epub.MaxImageSize)
+
+// ArticleEPUB downloads a single article as an EPUB book
+func (h *Handler) ArticleEPUB(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	article, err := h.db.GetArticle(r.Context(), userID(r), id)
+	if err != nil {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	book := &epub.Book{
+		ID:       fmt.Sprintf("urn:pocket-clone:article:%d", article.ID),
+		Title:    article.Title,
+		Author:   article.Author,
+		Chapters: []epub.Chapter{chapterFor(article)},
+	}
+	if book.Title == "" {
+		book.Title = article.URL
+	}
+
+	h.writeEPUB(w, r, book, book.Title)
+}
+
+// TagEPUB downloads every article with a tag as one EPUB book with a chapter
+// per article, oldest first
+func (h *Handler) TagEPUB(w http.ResponseWriter, r *http.Request) {
+	tagName := r.PathValue("tag")
+	if tagName == "" {
+		http.Error(w, "Tag name is required", http.StatusBadRequest)
+		return
+	}
+
+	summaries, _, err := h.db.ListArticles(r.Context(), userID(r), storage.ListOptions{
+		Filter: storage.Filter{AllTags: []string{tagName}},
+		Limit:  maxEPUBArticles,
+	})
+	if err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+	if len(summaries) == 0 {
+		http.Error(w, "No articles with this tag", http.StatusNotFound)
+		return
+	}
+
+	book := &epub.Book{
+		ID:    fmt.Sprintf("urn:pocket-clone:user:%d:tag:%s", userID(r), tagName),
+		Title: tagName,
+	}
+	for i := len(summaries) - 1; i >= 0; i-- {
+		article, err := h.db.GetArticle(r.Context(), userID(r), summaries[i].ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+			return
+		}
+		book.Chapters = append(book.Chapters, chapterFor(article))
+	}
+
+	h.writeEPUB(w, r, book, tagName)
+}
+
+func chapterFor(a *storage.Article) epub.Chapter {
+	return epub.Chapter{
+		Title:     a.Title,
+		Author:    a.Author,
+		SourceURL: a.URL,
+		Content:   a.Content,
+	}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// epubImageLoader reads archived images from the database and downloads
+// any that were never archived, until ctx is done
+func (h *Handler) epubImageLoader(ctx context.Context) epub.ImageLoader {
+	remote := epub.HTTPImageLoader(ctx, imageFetcher)
+	return func(src string, base *url.URL) ([]byte, string, error) {
+		if hash, ok := assets.HashFromPath(src); ok {
+			asset, err := h.db.GetAsset(ctx, hash)
+			if err != nil {
+				return nil, "", err
+			}
+			return asset.Data, asset.MediaType, nil
+		}
+		return remote(src, base)
+	}
+}
+
+func (h *Handler) writeEPUB(w http.ResponseWriter, r *http.Request, book *epub.Book, name string) {
+	// Downloading images can take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	ctx, cancel := context.WithTimeout(r.Context(), epubTimeout)
+	defer cancel()
+
+	filename := strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "-"), "-")
+	if filename == "" || len(filename) > 80 {
+		filename = "article"
+	}
+
+	// Render the whole book first so a failure can still be reported
+	var buf bytes.Buffer
+	if err := book.Write(&buf, h.epubImageLoader(ctx)); err != nil {
+		log.Printf("epub: %v", err)
+		http.Error(w, "Failed to generate EPUB", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.epub"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pocket-clone/internal/exporter"
+	"pocket-clone/internal/storage"
+)
+
+// Export streams the user's whole library as JSON, Netscape bookmark HTML or
+// CSV, selected with ?format= (default json).
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exporter.FormatJSON
+	}
+
+	ew, err := exporter.NewWriter(format, w)
+	if err != nil {
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+		return
+	}
+
+	// Large libraries can take longer than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	filename := fmt.Sprintf("pocket-clone-%s.%s", time.Now().Format("2006-01-02"), ew.Extension())
+	w.Header().Set("Content-Type", ew.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	err = h.db.ExportArticles(r.Context(), userID(r), func(a *storage.Article) error {
+		return ew.WriteArticle(a)
+	})
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		// Headers are already sent, so all we can do is cut the response short
+		log.Printf("export: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"pocket-clone/internal/storage"
+)
+
+// highlightColors are the colors clients can give a highlight
+var highlightColors = map[string]bool{
+	"yellow": true, "green": true, "blue": true, "pink": true, "purple": true,
+}
+
+// anchorContext is how many characters of surrounding text are stored as a
+// highlight's prefix and suffix when the client doesn't send them
+const anchorContext = 32
+
+type CreateHighlightRequest struct {
+	Quote  string `json:"quote"`
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	Start  *int   `json:"start"`
+	End    *int   `json:"end"`
+	Note   string `json:"note"`
+	Color  string `json:"color"`
+}
+
+type UpdateHighlightRequest struct {
+	Note  *string `json:"note,omitempty"`
+	Color *string `json:"color,omitempty"`
+}
+
+// HighlightPage is one page of the highlights feed. NextCursor is passed as
+// ?cursor= to get the next page and is left out on the last one.
+type HighlightPage struct {
+	Highlights []storage.Highlight `json:"highlights"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// CreateHighlight marks a passage of an article. Clients send the quoted
+// text, its offsets in the article's text_content, or both; whichever is
+// missing is filled in from the text.
+func (h *Handler) CreateHighlight(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateHighlightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Color == "" {
+		req.Color = "yellow"
+	}
+	if !highlightColors[req.Color] {
+		http.Error(w, "Unknown highlight color", http.StatusBadRequest)
+		return
+	}
+
+	article, err := h.db.GetArticle(r.Context(), userID(r), id)
+	if err != nil {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	highlight := &storage.Highlight{
+		ArticleID: id,
+		Quote:     req.Quote,
+		Prefix:    req.Prefix,
+		Suffix:    req.Suffix,
+		Start:     req.Start,
+		End:       req.End,
+		Note:      req.Note,
+		Color:     req.Color,
+	}
+	if err := anchor(article.TextContent, highlight); err != nil {
+		http.Error(w, "Invalid highlight: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.CreateHighlight(r.Context(), userID(r), highlight); err != nil {
+		http.Error(w, "Failed to save highlight", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(highlight)
+}
+
+func (h *Handler) ListHighlights(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	highlights, err := h.db.ListHighlights(r.Context(), userID(r), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch highlights", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(highlights)
+}
+
+// UpdateHighlight changes a highlight's note or color. The highlighted
+// passage itself can't be changed; delete and recreate it instead.
+func (h *Handler) UpdateHighlight(w http.ResponseWriter, r *http.Request) {
+	id, highlightID, ok := highlightIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateHighlightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Color != nil && !highlightColors[*req.Color] {
+		http.Error(w, "Unknown highlight color", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.UpdateHighlight(r.Context(), userID(r), id, highlightID, req.Note, req.Color); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Highlight not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update highlight", http.StatusInternalServerError)
+		return
+	}
+
+	highlight, err := h.db.GetHighlight(r.Context(), userID(r), id, highlightID)
+	if err != nil {
+		http.Error(w, "Failed to fetch highlight", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(highlight)
+}
+
+func (h *Handler) DeleteHighlight(w http.ResponseWriter, r *http.Request) {
+	id, highlightID, ok := highlightIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteHighlight(r.Context(), userID(r), id, highlightID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Highlight not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete highlight", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAllHighlights is the feed of a user's highlights across articles,
+// newest first
+func (h *Handler) ListAllHighlights(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 50
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	highlights, next, err := h.db.ListAllHighlights(r.Context(), userID(r), limit, query.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to fetch highlights", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HighlightPage{Highlights: highlights, NextCursor: next})
+}
+
+func highlightIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	highlightID, err := strconv.ParseInt(r.PathValue("highlight"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid highlight ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return id, highlightID, true
+}
+
+// anchor completes a highlight against the article text. Offsets, if given,
+// must lie within the text and supply a missing quote. Otherwise the quote
+// is looked up in the text, preferring the occurrence whose surroundings
+// match the prefix and suffix; a quote that can't be found is kept without
+// offsets.
+func anchor(text string, h *storage.Highlight) error {
+	runes := []rune(text)
+
+	if h.Start != nil || h.End != nil {
+		if h.Start == nil || h.End == nil || *h.Start < 0 || *h.End <= *h.Start || *h.End > len(runes) {
+			return errors.New("offsets are outside the article text")
+		}
+		if h.Quote == "" {
+			h.Quote = string(runes[*h.Start:*h.End])
+		}
+		fillContext(runes, h)
+		return nil
+	}
+
+	if strings.TrimSpace(h.Quote) == "" {
+		return errors.New("quote or offsets are required")
+	}
+
+	found := -1
+	for from := 0; from < len(text); {
+		i := strings.Index(text[from:], h.Quote)
+		if i < 0 {
+			break
+		}
+		i += from
+		if found < 0 {
+			found = i
+		}
+		if strings.HasSuffix(text[:i], h.Prefix) && strings.HasPrefix(text[i+len(h.Quote):], h.Suffix) {
+			found = i
+			break
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		from = i + size
+	}
+	if found < 0 {
+		return nil
+	}
+
+	start := utf8.RuneCountInString(text[:found])
+	end := start + utf8.RuneCountInString(h.Quote)
+	h.Start, h.End = &start, &end
+	fillContext(runes, h)
+	return nil
+}
+
+func fillContext(runes []rune, h *storage.Highlight) {
+	if h.Prefix == "" {
+		h.Prefix = string(runes[max(*h.Start-anchorContext, 0):*h.Start])
+	}
+	if h.Suffix == "" {
+		h.Suffix = string(runes[*h.End:min(*h.End+anchorContext, len(runes))])
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pocket-clone/internal/importer"
+)
+
+// maxImportSize caps the size of an uploaded export file
+const maxImportSize = 64 << 20
+
+// importReadTimeout bounds uploading an export file. The server's read
+// timeout is too short for a large file on a slow connection.
+const importReadTimeout = 10 * time.Minute
+
+// Import reads a Pocket, Instapaper or Omnivore export, either as a
+// multipart "file" field or as the raw request body, and responds with an
+// import summary. Clients that accept application/x-ndjson get progress
+// events streamed before the summary.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	// Uploading and importing a large file can take longer than the
+	// server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(importReadTimeout))
+	rc.SetWriteDeadline(time.Time{})
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	format := r.URL.Query().Get("format")
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Export file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+
+		if f := r.FormValue("format"); f != "" {
+			format = f
+		}
+	}
+
+	items, err := importer.Parse(body, format)
+	if err != nil {
+		if errors.Is(err, importer.ErrUnknownFormat) {
+			http.Error(w, "Unknown import format", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to read export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		summary := importer.Import(r.Context(), h.db, h.queue, userID(r), items, nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+
+	summary := importer.Import(r.Context(), h.db, h.queue, userID(r), items, func(p importer.Progress) {
+		if p.Processed%100 == 0 || p.Processed == p.Total {
+			enc.Encode(p)
+			rc.Flush()
+		}
+	})
+	enc.Encode(summary)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pocket-clone/internal/storage"
+)
+
+type UpdateProgressRequest struct {
+	// Percent is how much of the article has been read, from 0 to 100
+	Percent *float64 `json:"percent,omitempty"`
+	// Offset is the character offset into the article's text_content
+	Offset *int `json:"offset,omitempty"`
+	// UpdatedAt is when the client recorded this position
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// OpenedAt is when the client opened the article
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+type ProgressResponse struct {
+	storage.ReadingProgress
+	// Applied is false when a newer position was already stored
+	Applied bool `json:"applied"`
+}
+
+// UpdateProgress saves a client's reading position. Positions are
+// last-write-wins by the client's updated_at, so a device that syncs late
+// doesn't move the position backwards. The response holds the stored
+// position, whether or not this update won.
+func (h *Handler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Percent != nil && (*req.Percent < 0 || *req.Percent > 100) {
+		http.Error(w, "Percent must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	if req.Offset != nil && *req.Offset < 0 {
+		http.Error(w, "Offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	// A client clock running fast would otherwise win every later update
+	now := time.Now()
+	update := storage.ProgressUpdate{Percent: req.Percent, Offset: req.Offset, OpenedAt: req.OpenedAt}
+	if req.Percent != nil || req.Offset != nil {
+		if req.UpdatedAt == nil {
+			http.Error(w, "updated_at is required", http.StatusBadRequest)
+			return
+		}
+		update.UpdatedAt = *req.UpdatedAt
+		if update.UpdatedAt.After(now) {
+			update.UpdatedAt = now
+		}
+	}
+	if update.OpenedAt != nil && update.OpenedAt.After(now) {
+		update.OpenedAt = &now
+	}
+
+	applied, err := h.db.UpdateProgress(r.Context(), userID(r), id, update)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update progress", http.StatusInternalServerError)
+		return
+	}
+
+	progress, err := h.db.GetProgress(r.Context(), userID(r), id)
+	if err != nil {
+		http.Error(w, "Failed to get progress", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProgressResponse{ReadingProgress: *progress, Applied: applied})
+}
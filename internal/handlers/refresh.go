@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pocket-clone/internal/ingest"
+	"pocket-clone/internal/storage"
+)
+
+// refreshTimeout bounds fetching an article's page and images again, which
+// isn't limited by the server's write timeout
+const refreshTimeout = 2 * time.Minute
+
+type RefreshResponse struct {
+	Queued int `json:"queued"`
+}
+
+// RefreshArticle fetches and parses an article's page again and returns the
+// updated article. The previous content is kept as a revision. If the page
+// can't be fetched the article is left unchanged.
+func (h *Handler) RefreshArticle(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	article, err := h.db.GetArticle(r.Context(), userID(r), id)
+	if err != nil {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if article.Status == storage.StatusPending {
+		http.Error(w, "Article is still being fetched", http.StatusConflict)
+		return
+	}
+
+	// Fetching the page and its images can take longer than the server's
+	// write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	ctx, cancel := context.WithTimeout(r.Context(), refreshTimeout)
+	defer cancel()
+
+	err = h.queue.Refresh(ctx, article.ID, article.URL)
+	if errors.Is(err, ingest.ErrQueued) {
+		http.Error(w, "Article is already being refreshed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to refresh article: "+err.Error(), fetchErrorStatus(err))
+		return
+	}
+
+	article, err = h.db.GetArticle(r.Context(), userID(r), id)
+	if err != nil {
+		http.Error(w, "Failed to get article", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+// fetchErrorStatus maps an error from fetching a page to a status code: the
+// client's fault for URLs that can't be fetched or pages that aren't
+// articles, and a gateway error when the remote site fails
+func fetchErrorStatus(err error) int {
+	switch ingest.ErrorKind(err) {
+	case ingest.KindUnsupportedScheme:
+		return http.StatusBadRequest
+	case ingest.KindBlockedAddress:
+		return http.StatusForbidden
+	case ingest.KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ingest.KindUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	case ingest.KindTimeout:
+		return http.StatusGatewayTimeout
+	case ingest.KindCancelled:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// RefreshArticles queues every article, or those with ?tag=, to be fetched
+// and parsed again in the background. Articles that are still queued from
+// an earlier call are not queued again or counted.
+func (h *Handler) RefreshArticles(w http.ResponseWriter, r *http.Request) {
+	articles, err := h.db.ListRefreshable(r.Context(), userID(r), r.URL.Query().Get("tag"))
+	if err != nil {
+		http.Error(w, "Failed to list articles", http.StatusInternalServerError)
+		return
+	}
+
+	queued := h.queue.RefreshAll(articles)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RefreshResponse{Queued: queued})
+}
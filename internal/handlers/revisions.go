@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pocket-clone/internal/diff"
+	"pocket-clone/internal/storage"
+)
+
+// diffContext is the number of unchanged lines shown around each change in
+// text diffs
+const diffContext = 3
+
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := h.db.ListRevisions(r.Context(), userID(r), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list revisions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// RevisionDiff compares the text of a revision with the version that
+// replaced it, or with another revision given as ?to=. ?format=html returns
+// the whole text with changes marked instead of a unified diff.
+func (h *Handler) RevisionDiff(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+	revID, err := strconv.ParseInt(r.PathValue("rev"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "html" {
+		http.Error(w, "Unknown diff format", http.StatusBadRequest)
+		return
+	}
+
+	from, err := h.db.GetRevision(r.Context(), userID(r), id, revID)
+	if err != nil {
+		h.revisionError(w, err)
+		return
+	}
+
+	var to *storage.Revision
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		toID, err := strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+			return
+		}
+		to, err = h.db.GetRevision(r.Context(), userID(r), id, toID)
+		if err != nil {
+			h.revisionError(w, err)
+			return
+		}
+	} else {
+		to, err = h.db.GetNextRevision(r.Context(), userID(r), id, revID)
+		if err != nil {
+			h.revisionError(w, err)
+			return
+		}
+	}
+
+	lines := diff.Lines(splitLines(from.TextContent), splitLines(to.TextContent))
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, diff.HTML(lines))
+		return
+	}
+
+	toName := "current"
+	if to.ID != 0 {
+		toName = fmt.Sprintf("revision %d", to.ID)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, diff.Unified(lines, fmt.Sprintf("revision %d", from.ID), toName, diffContext))
+}
+
+func (h *Handler) revisionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to get revision", http.StatusInternalServerError)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
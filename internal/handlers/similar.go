@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pocket-clone/internal/storage"
+)
+
+// SimilarArticles lists the articles most like one article, most similar
+// first. It takes the same filters as article lists.
+func (h *Handler) SimilarArticles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	opts, ok := nearestOptions(w, r)
+	if !ok {
+		return
+	}
+	opts.Exclude = id
+
+	vector, err := h.db.GetArticleVector(r.Context(), userID(r), id, h.embedder.Model())
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to find similar articles", http.StatusInternalServerError)
+		return
+	}
+
+	// Articles without content yet, or not indexed yet, have no vector and
+	// nothing similar
+	articles := []storage.Article{}
+	if vector != nil {
+		articles, err = h.db.NearestArticles(r.Context(), userID(r), h.embedder.Model(), vector, opts)
+		if err != nil {
+			http.Error(w, "Failed to find similar articles", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArticlePage{Articles: articles})
+}
+
+// semanticSearch ranks articles by the similarity of their vectors to the
+// query's, so that articles about the query's subject are found without
+// containing its words. Results have a single page.
+func (h *Handler) semanticSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, ok := nearestOptions(w, r)
+	if !ok {
+		return
+	}
+
+	vector, err := h.embedder.Embed(q)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+	articles, err := h.db.NearestArticles(r.Context(), userID(r), h.embedder.Model(), vector, opts)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArticlePage{Articles: articles})
+}
+
+// nearestOptions reads the filters and limit of a similarity search,
+// writing an error response if they are invalid
+func nearestOptions(w http.ResponseWriter, r *http.Request) (storage.NearestOptions, bool) {
+	params := r.URL.Query()
+	filter, err := parseFilter(params)
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return storage.NearestOptions{}, false
+	}
+
+	limit := 10
+	if l := params.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 50 {
+			limit = parsed
+		}
+	}
+	return storage.NearestOptions{Filter: filter, Limit: limit}, true
+}
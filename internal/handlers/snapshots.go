@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"pocket-clone/internal/parser"
+	"pocket-clone/internal/snapshot"
+	"pocket-clone/internal/storage"
+)
+
+// snapshotPolicy lets a snapshot load its styles, images and fonts but never
+// run scripts or touch our origin
+const snapshotPolicy = "default-src 'none'; img-src data: http: https:; style-src 'unsafe-inline' data: http: https:; " +
+	"font-src data: http: https:; media-src data: http: https:; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// GetSnapshot serves the page an article was extracted from. ?kind=raw or
+// ?kind=single-file picks a snapshot; by default the single-file snapshot
+// is served when there is one.
+func (h *Handler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != storage.SnapshotRaw && kind != storage.SnapshotSingleFile {
+		http.Error(w, "Unknown snapshot kind", http.StatusBadRequest)
+		return
+	}
+
+	snap, err := h.db.GetSnapshot(r.Context(), userID(r), id, kind)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	data := snap.Data
+	if snap.Kind == storage.SnapshotRaw && isHTML(snap.MediaType) {
+		// Resolve the page's relative URLs against the original site
+		data = snapshot.WithBase(data, snap.URL)
+	}
+
+	w.Header().Set("Content-Type", snap.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Security-Policy", snapshotPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Snapshot-Kind", snap.Kind)
+	w.Write(data)
+}
+
+// GetOriginal serves the file an article was saved from as it was
+// downloaded. PDFs open in the browser's viewer; pages are downloaded, as
+// their scripts must not run on our origin. Either way the file is
+// untrusted, so it gets the snapshot policy too: a PDF can carry scripts
+// and forms of its own.
+func (h *Handler) GetOriginal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	snap, err := h.db.GetSnapshot(r.Context(), userID(r), id, storage.SnapshotRaw)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Original not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get original", http.StatusInternalServerError)
+		return
+	}
+
+	disposition := "attachment"
+	if mediaType, _, _ := mime.ParseMediaType(snap.MediaType); mediaType == parser.MediaTypePDF {
+		disposition = "inline"
+	}
+	if name := originalFilename(snap.URL); name != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": name})
+	}
+
+	w.Header().Set("Content-Type", snap.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(snap.Data)))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Security-Policy", snapshotPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(snap.Data)
+}
+
+// isHTML reports whether a snapshot's media type is a web page
+func isHTML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// originalFilename returns the last segment of a URL's path, or ""
+func originalFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || strings.TrimSpace(name) == "" {
+		return ""
+	}
+	return name
+}
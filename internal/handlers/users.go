@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"pocket-clone/internal/auth"
+	"pocket-clone/internal/storage"
+)
+
+const minPasswordLength = 8
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CreateUser registers an account. Anyone may create the first account;
+// after that only signed-in users can add accounts for their teammates.
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	// Turn away anonymous signups early, before hashing the password.
+	// CreateFirstUser makes the final check atomically.
+	anonymous := auth.UserFromContext(r.Context()) == nil
+	if anonymous {
+		count, err := h.db.CountUsers(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to check users", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pocket-clone"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || strings.Contains(req.Username, ":") {
+		http.Error(w, "A username without colons is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	create := h.db.CreateUser
+	if anonymous {
+		create = h.db.CreateFirstUser
+	}
+	user, err := create(r.Context(), req.Username, hash)
+	if errors.Is(err, storage.ErrUsersExist) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="pocket-clone"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		if _, _, lookupErr := h.db.GetUserByUsername(r.Context(), req.Username); lookupErr == nil {
+			http.Error(w, "Username is taken", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetCurrentUser returns the authenticated user
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auth.UserFromContext(r.Context()))
+}
@@ -0,0 +1,321 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Supported export formats
+const (
+	FormatPocketHTML = "pocket-html"
+	FormatPocketCSV  = "pocket-csv"
+	FormatInstapaper = "instapaper"
+	FormatOmnivore   = "omnivore"
+)
+
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Item is one saved link read from an export file
+type Item struct {
+	URL      string
+	Title    string
+	Tags     []string
+	SavedAt  time.Time
+	ReadAt   *time.Time
+	Archived bool
+}
+
+// Parse reads an export file. An empty format is detected from the content.
+func Parse(r io.Reader, format string) ([]Item, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = Detect(data)
+	}
+
+	switch format {
+	case FormatPocketHTML:
+		return parsePocketHTML(data)
+	case FormatPocketCSV:
+		return parsePocketCSV(data)
+	case FormatInstapaper:
+		return parseInstapaper(data)
+	case FormatOmnivore:
+		return parseOmnivore(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Detect guesses the format of an export file from its content
+func Detect(data []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '[', '{':
+		return FormatOmnivore
+	case '<':
+		return FormatPocketHTML
+	}
+
+	header, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	header = bytes.ToLower(header)
+	switch {
+	case bytes.Contains(header, []byte("time_added")):
+		return FormatPocketCSV
+	case bytes.Contains(header, []byte("folder")):
+		return FormatInstapaper
+	}
+
+	return ""
+}
+
+// parsePocketHTML reads the classic Pocket export: a list of links under an
+// "Unread" heading followed by a "Read Archive" heading.
+func parsePocketHTML(data []byte) ([]Item, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	archived := false
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "h1":
+				archived = strings.Contains(strings.ToLower(textOf(n)), "archive")
+			case "a":
+				item := Item{
+					URL:      attr(n, "href"),
+					Title:    strings.TrimSpace(textOf(n)),
+					Tags:     splitTags(attr(n, "tags"), ","),
+					SavedAt:  unixTime(attr(n, "time_added")),
+					Archived: archived,
+				}
+				if item.Archived {
+					item.ReadAt = &item.SavedAt
+				}
+				items = append(items, item)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return items, nil
+}
+
+// parsePocketCSV reads the newer Pocket export with the columns
+// title, url, time_added, tags (separated by "|") and status.
+func parsePocketCSV(data []byte) ([]Item, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(rows))
+	for _, row := range rows {
+		item := Item{
+			URL:      row["url"],
+			Title:    row["title"],
+			Tags:     splitTags(row["tags"], "|"),
+			SavedAt:  unixTime(row["time_added"]),
+			Archived: strings.EqualFold(row["status"], "archive"),
+		}
+		if item.Archived {
+			item.ReadAt = &item.SavedAt
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseInstapaper reads the Instapaper CSV export with the columns URL,
+// Title, Selection, Folder, Timestamp and, in newer exports, Tags. Folders
+// other than Unread, Archive and Starred become tags.
+func parseInstapaper(data []byte) ([]Item, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(rows))
+	for _, row := range rows {
+		item := Item{
+			URL:     row["url"],
+			Title:   row["title"],
+			SavedAt: unixTime(row["timestamp"]),
+		}
+
+		if tags := row["tags"]; tags != "" {
+			var list []string
+			if err := json.Unmarshal([]byte(tags), &list); err == nil {
+				item.Tags = list
+			} else {
+				item.Tags = splitTags(tags, ",")
+			}
+		}
+
+		switch folder := row["folder"]; strings.ToLower(folder) {
+		case "", "unread", "starred":
+		case "archive":
+			item.Archived = true
+			item.ReadAt = &item.SavedAt
+		default:
+			item.Tags = append(item.Tags, folder)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+type omnivoreItem struct {
+	URL             string   `json:"url"`
+	Title           string   `json:"title"`
+	Labels          []string `json:"labels"`
+	State           string   `json:"state"`
+	ReadingProgress float64  `json:"readingProgress"`
+	SavedAt         string   `json:"savedAt"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+
+// parseOmnivore reads the metadata JSON from an Omnivore export. Files
+// contain an array of items; a single object is accepted as well.
+func parseOmnivore(data []byte) ([]Item, error) {
+	var raw []omnivoreItem
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var single omnivoreItem
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil, err
+		}
+		raw = []omnivoreItem{single}
+	}
+
+	items := make([]Item, 0, len(raw))
+	for _, o := range raw {
+		item := Item{
+			URL:      o.URL,
+			Title:    o.Title,
+			Tags:     o.Labels,
+			SavedAt:  isoTime(o.SavedAt),
+			Archived: strings.EqualFold(o.State, "archived"),
+		}
+		if o.ReadingProgress >= 100 {
+			readAt := isoTime(o.UpdatedAt)
+			if readAt.IsZero() {
+				readAt = item.SavedAt
+			}
+			item.ReadAt = &readAt
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// readCSV returns the rows of a CSV file keyed by lower-cased header names
+func readCSV(data []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	rows := make([]map[string]string, 0, len(records)-1)
+	for line, record := range records[1:] {
+		if len(record) > len(header) {
+			return nil, fmt.Errorf("line %d: too many fields", line+2)
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range record {
+			row[header[i]] = strings.TrimSpace(value)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textOf(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func splitTags(s, sep string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, sep) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func unixTime(s string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
+func isoTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
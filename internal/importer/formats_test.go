@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"pocket html", "<!DOCTYPE NETSCAPE-Bookmark-file-1>\n<html><body><h1>Unread</h1></body></html>", FormatPocketHTML},
+		{"pocket html with bom and blank lines", "\xef\xbb\xbf\n\n  <html></html>", FormatPocketHTML},
+		{"pocket csv", "title,url,time_added,tags,status\nA,https://a.example,1700000000,,unread\n", FormatPocketCSV},
+		{"pocket csv with bom", "\xef\xbb\xbfTitle,URL,Time_Added,Tags,Status\n", FormatPocketCSV},
+		{"instapaper", "URL,Title,Selection,Folder,Timestamp\nhttps://a.example,A,,Unread,1700000000\n", FormatInstapaper},
+		{"instapaper with tags", "URL,Title,Selection,Folder,Timestamp,Tags\r\n", FormatInstapaper},
+		{"omnivore array", `[{"url": "https://a.example"}]`, FormatOmnivore},
+		{"omnivore object", `  {"url": "https://a.example"}`, FormatOmnivore},
+		{"empty", "", ""},
+		{"whitespace", " \n\t", ""},
+		{"unknown csv", "name,address\nA,B\n", ""},
+		{"plain text", "https://a.example\nhttps://b.example\n", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: Detect = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// summary describes items compactly for comparison
+func summary(items []Item) string {
+	var lines []string
+	for _, it := range items {
+		readAt := "-"
+		if it.ReadAt != nil {
+			readAt = it.ReadAt.Format(time.RFC3339)
+		}
+		lines = append(lines, fmt.Sprintf("%s %q %q %s archived=%v read=%s",
+			it.URL, it.Title, it.Tags, it.SavedAt.Format(time.RFC3339), it.Archived, readAt))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		want   string
+	}{
+		{
+			"pocket html", "",
+			`<!DOCTYPE html><html><body>
+<h1>Unread</h1>
+<ul><li><a href="https://a.example/" time_added="1700000000" tags="go,to read">A &amp; B</a></li></ul>
+<h1>Read Archive</h1>
+<ul><li><a href="https://b.example/" time_added="1700000100" tags="">B</a></li></ul>
+</body></html>`,
+			`https://a.example/ "A & B" ["go" "to read"] 2023-11-14T22:13:20Z archived=false read=-` + "\n" +
+				`https://b.example/ "B" [] 2023-11-14T22:15:00Z archived=true read=2023-11-14T22:15:00Z`,
+		},
+		{
+			"pocket csv", "",
+			"title,url,time_added,tags,status\n" +
+				"A,https://a.example/,1700000000,go|web,unread\n" +
+				"\"B, quoted\",https://b.example/,1700000100,,archive\n",
+			`https://a.example/ "A" ["go" "web"] 2023-11-14T22:13:20Z archived=false read=-` + "\n" +
+				`https://b.example/ "B, quoted" [] 2023-11-14T22:15:00Z archived=true read=2023-11-14T22:15:00Z`,
+		},
+		{
+			"instapaper", "",
+			"URL,Title,Selection,Folder,Timestamp,Tags\n" +
+				"https://a.example/,A,,Unread,1700000000,\"[\"\"go\"\"]\"\n" +
+				"https://b.example/,B,,Archive,1700000100,\n" +
+				"https://c.example/,C,,Recipes,1700000200,\"x, y\"\n" +
+				"https://d.example/,D,,Starred,bad,\n",
+			`https://a.example/ "A" ["go"] 2023-11-14T22:13:20Z archived=false read=-` + "\n" +
+				`https://b.example/ "B" [] 2023-11-14T22:15:00Z archived=true read=2023-11-14T22:15:00Z` + "\n" +
+				`https://c.example/ "C" ["x" "y" "Recipes"] 2023-11-14T22:16:40Z archived=false read=-` + "\n" +
+				`https://d.example/ "D" [] 0001-01-01T00:00:00Z archived=false read=-`,
+		},
+		{
+			"omnivore", "",
+			`[{"url": "https://a.example/", "title": "A", "labels": ["go"], "state": "SUCCEEDED", "savedAt": "2023-11-14T22:13:20.000Z"},
+			  {"url": "https://b.example/", "title": "B", "state": "Archived", "readingProgress": 100,
+			   "savedAt": "2023-11-14T22:15:00+01:00", "updatedAt": "2023-11-15T08:00:00Z"},
+			  {"url": "https://c.example/", "readingProgress": 100, "savedAt": "2023-11-14T22:16:40Z"}]`,
+			`https://a.example/ "A" ["go"] 2023-11-14T22:13:20Z archived=false read=-` + "\n" +
+				`https://b.example/ "B" [] 2023-11-14T21:15:00Z archived=true read=2023-11-15T08:00:00Z` + "\n" +
+				`https://c.example/ "" [] 2023-11-14T22:16:40Z archived=false read=2023-11-14T22:16:40Z`,
+		},
+		{
+			"omnivore single object", "",
+			`{"url": "https://a.example/", "title": "A"}`,
+			`https://a.example/ "A" [] 0001-01-01T00:00:00Z archived=false read=-`,
+		},
+		{
+			"format given", FormatPocketCSV,
+			"title,url,time_added\nA,https://a.example/,1700000000\n",
+			`https://a.example/ "A" [] 2023-11-14T22:13:20Z archived=false read=-`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := Parse(strings.NewReader(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := summary(items); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		unknown bool
+	}{
+		{"undetectable", "", "just some text", true},
+		{"unknown format", "delicious", "<html></html>", true},
+		{"broken json", FormatOmnivore, `[{"url": `, false},
+		{"too many fields", FormatPocketCSV, "title,url\nA,https://a.example/,extra\n", false},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.data), tt.format)
+		if err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		} else if errors.Is(err, ErrUnknownFormat) != tt.unknown {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
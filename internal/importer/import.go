@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"context"
+
+	"pocket-clone/internal/ingest"
+	"pocket-clone/internal/parser"
+	"pocket-clone/internal/storage"
+)
+
+// Progress is reported after each item has been handled
+type Progress struct {
+	Processed int `json:"processed"`
+	Total     int `json:"total"`
+}
+
+type Failure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// Summary describes the outcome of an import. Imported articles are saved
+// as pending and fetched by the ingest queue afterwards.
+type Summary struct {
+	Total      int       `json:"total"`
+	Imported   int       `json:"imported"`
+	Duplicates int       `json:"duplicates"`
+	Failed     int       `json:"failed"`
+	Failures   []Failure `json:"failures,omitempty"`
+}
+
+// Import saves items into a user's library and queues them for fetching.
+// URLs the user has already saved are counted as duplicates and left alone.
+// With a nil queue the articles stay pending until the server picks them up.
+// Cancelling ctx stops the import after the current item.
+func Import(ctx context.Context, db *storage.SQLiteDB, queue *ingest.Queue, userID int64, items []Item, progress func(Progress)) Summary {
+	summary := Summary{Total: len(items)}
+	var created []storage.Article
+
+	for i, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		id, articleURL, err := importItem(ctx, db, userID, item)
+		switch {
+		case err != nil:
+			summary.Failed++
+			summary.Failures = append(summary.Failures, Failure{URL: item.URL, Error: err.Error()})
+		case id == 0:
+			summary.Duplicates++
+		default:
+			summary.Imported++
+			created = append(created, storage.Article{ID: id, URL: articleURL})
+		}
+
+		if progress != nil {
+			progress(Progress{Processed: i + 1, Total: len(items)})
+		}
+	}
+
+	if queue != nil {
+		queue.EnqueueAll(created)
+	}
+
+	return summary
+}
+
+// importItem saves one item with its tags. It returns a zero ID for
+// duplicates.
+func importItem(ctx context.Context, db *storage.SQLiteDB, userID int64, item Item) (int64, string, error) {
+	articleURL, err := parser.NormalizeURL(item.URL)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, created, err := db.ImportArticle(ctx, userID, &storage.Article{
+		URL:      articleURL,
+		Title:    item.Title,
+		SavedAt:  item.SavedAt,
+		ReadAt:   item.ReadAt,
+		Archived: item.Archived,
+		Tags:     item.Tags,
+	})
+	if err != nil || !created {
+		return 0, "", err
+	}
+
+	return id, articleURL, nil
+}
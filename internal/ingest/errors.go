@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"pocket-clone/internal/fetch"
+)
+
+// Kinds of fetch failures, stored with a failed article's error so clients
+// can tell them apart without parsing the message
+const (
+	KindUnsupportedScheme = "unsupported_scheme"
+	KindBlockedAddress    = "blocked_address"
+	KindTooLarge          = "too_large"
+	KindUnsupportedType   = "unsupported_type"
+	KindHTTPStatus        = "http_status"
+	KindTimeout           = "timeout"
+	KindUnreachable       = "unreachable"
+	KindCancelled         = "cancelled"
+	// KindExtraction is a page that was downloaded but couldn't be read
+	KindExtraction = "extraction"
+)
+
+// ErrorKind classifies an error from fetching and parsing an article
+func ErrorKind(err error) string {
+	var statusErr *fetch.StatusError
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, fetch.ErrUnsupportedScheme):
+		return KindUnsupportedScheme
+	case errors.Is(err, fetch.ErrBlockedAddress):
+		return KindBlockedAddress
+	case errors.Is(err, fetch.ErrTooLarge):
+		return KindTooLarge
+	case errors.Is(err, fetch.ErrUnsupportedType):
+		return KindUnsupportedType
+	case errors.As(err, &statusErr):
+		return KindHTTPStatus
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindCancelled
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return KindUnreachable
+	default:
+		return KindExtraction
+	}
+}
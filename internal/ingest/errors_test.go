@@ -0,0 +1,50 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/parser"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorKind(t *testing.T) {
+	dial := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"scheme", fetch.ErrUnsupportedScheme, KindUnsupportedScheme},
+		{"blocked when checking the URL", fmt.Errorf("%w: 127.0.0.1", fetch.ErrBlockedAddress), KindBlockedAddress},
+		{"blocked when dialing", dial(fmt.Errorf("%w: 10.0.0.1", fetch.ErrBlockedAddress)), KindBlockedAddress},
+		{"too large", fmt.Errorf("%w: 30000000 bytes", fetch.ErrTooLarge), KindTooLarge},
+		{"unsupported type", fmt.Errorf("%w: image/png", fetch.ErrUnsupportedType), KindUnsupportedType},
+		{"status", &fetch.StatusError{StatusCode: 404, Status: "404 Not Found"}, KindHTTPStatus},
+		{"deadline", dial(context.DeadlineExceeded), KindTimeout},
+		{"network timeout", dial(timeoutError{}), KindTimeout},
+		{"cancelled", dial(context.Canceled), KindCancelled},
+		{"connection refused", dial(errors.New("connection refused")), KindUnreachable},
+		{"dns", &url.Error{Op: "Get", URL: "https://nowhere.invalid/", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid"}}, KindUnreachable},
+		{"site rule", parser.ErrNoMatch, KindExtraction},
+		{"readability", errors.New("failed to parse page"), KindExtraction},
+	}
+	for _, tt := range tests {
+		if got := ErrorKind(tt.err); got != tt.want {
+			t.Errorf("%s: ErrorKind(%v) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"pocket-clone/internal/assets"
+	"pocket-clone/internal/embed"
+	"pocket-clone/internal/parser"
+	"pocket-clone/internal/snapshot"
+	"pocket-clone/internal/storage"
+)
+
+// queueSize bounds how many saved articles can wait for a worker. Articles
+// saved while the queue is full stay pending until the next sweep.
+const queueSize = 1024
+
+// ErrQueued is returned by Refresh for an article that is already waiting
+// for or being fetched by a worker
+var ErrQueued = errors.New("article is already being fetched")
+
+// sweepInterval is how often pending articles that didn't fit in the queue
+// are looked for
+const sweepInterval = time.Minute
+
+type job struct {
+	id  int64
+	url string
+	// refresh re-fetches an article that already has content, which is
+	// kept if fetching fails
+	refresh bool
+}
+
+// Queue fetches and parses saved articles in the background so that saving
+// an article doesn't have to wait for the remote site.
+type Queue struct {
+	// OnProcessed, if set before Start, is called after each article has
+	// been fetched, with the error if fetching or parsing failed.
+	OnProcessed func(id int64, err error)
+
+	// SingleFile, if set before Start, also stores a self-contained copy of
+	// each page with its stylesheets and images inlined. The raw HTML is
+	// always kept.
+	SingleFile bool
+
+	// Embedder computes the vectors of similar-article search for each
+	// article once it is saved. New sets it to embed.NewHashing(); change it
+	// before Start.
+	Embedder embed.Embedder
+
+	db      *storage.SQLiteDB
+	workers int
+	jobs    chan job
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	pending sync.WaitGroup
+	// queued holds the articles waiting for or being fetched, so that
+	// sweeps and repeated refreshes don't queue them twice and a refresh
+	// doesn't fetch an article a worker is fetching
+	mu     sync.Mutex
+	queued map[int64]bool
+	// ctx is cancelled by Stop to abandon the articles being fetched
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New(db *storage.SQLiteDB, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		Embedder: embed.NewHashing(),
+		db:       db,
+		workers:  workers,
+		jobs:     make(chan job, queueSize),
+		queued:   make(map[int64]bool),
+		quit:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start launches the worker pool and the sweep for pending articles, and
+// indexes the articles that have no vector yet in the background
+func (q *Queue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	q.wg.Add(1)
+	go q.sweep()
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		if err := embed.Index(q.ctx, q.db, q.Embedder); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("ingest: failed to index articles: %v", err)
+		}
+	}()
+}
+
+// EnqueuePending re-queues articles that were still pending when the
+// server last stopped
+func (q *Queue) EnqueuePending(ctx context.Context) error {
+	pending, err := q.db.ListPendingArticles(ctx)
+	if err != nil {
+		return err
+	}
+	q.EnqueueAll(pending)
+	return nil
+}
+
+// Enqueue schedules an article for fetching without blocking. If the queue
+// is full the article stays pending and is picked up by the next sweep. It
+// returns false if the queue has been stopped, in which case the article is
+// picked up again on the next start.
+func (q *Queue) Enqueue(id int64, url string) bool {
+	select {
+	case <-q.quit:
+		return false
+	default:
+	}
+	q.offer(job{id: id, url: url})
+	return true
+}
+
+// offer hands an article to the workers if there is room in the queue,
+// reporting whether there was. An article that is already queued counts as
+// handed over.
+func (q *Queue) offer(j job) bool {
+	if !q.claim(j) {
+		return true
+	}
+	q.pending.Add(1)
+	select {
+	case q.jobs <- j:
+		return true
+	default:
+		q.pending.Done()
+		q.release(j)
+		return false
+	}
+}
+
+// sweep periodically queues pending articles that were saved while the
+// queue was full, as many as fit
+func (q *Queue) sweep() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.quit:
+			return
+		}
+
+		pending, err := q.db.ListPendingArticles(q.ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Printf("ingest: failed to list pending articles: %v", err)
+			}
+			continue
+		}
+		for _, a := range pending {
+			if !q.offer(job{id: a.ID, url: a.URL}) {
+				break
+			}
+		}
+	}
+}
+
+// claim records that an article is being queued or refreshed, returning
+// false if it already is
+func (q *Queue) claim(j job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued[j.id] {
+		return false
+	}
+	q.queued[j.id] = true
+	return true
+}
+
+// release undoes claim once the article is fetched or can't be queued
+func (q *Queue) release(j job) {
+	q.mu.Lock()
+	delete(q.queued, j.id)
+	q.mu.Unlock()
+}
+
+// EnqueueAll schedules a batch of articles without blocking the caller
+func (q *Queue) EnqueueAll(articles []storage.Article) {
+	q.enqueueAll(articles, false)
+}
+
+// RefreshAll schedules a batch of saved articles to be fetched and parsed
+// again without blocking the caller. It returns how many were scheduled;
+// articles that are queued already are skipped.
+func (q *Queue) RefreshAll(articles []storage.Article) int {
+	return q.enqueueAll(articles, true)
+}
+
+// Refresh fetches and parses a saved article again right away, updating it
+// if its content has changed. The article is left as it was if fetching
+// fails or ctx is cancelled. It returns ErrQueued if the article is queued
+// or being fetched already.
+func (q *Queue) Refresh(ctx context.Context, id int64, url string) error {
+	j := job{id: id, url: url, refresh: true}
+	if !q.claim(j) {
+		return ErrQueued
+	}
+	defer q.release(j)
+	return q.fetch(ctx, j)
+}
+
+func (q *Queue) enqueueAll(articles []storage.Article, refresh bool) int {
+	var jobs []job
+	for _, a := range articles {
+		if j := (job{id: a.ID, url: a.URL, refresh: refresh}); q.claim(j) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	q.pending.Add(len(jobs))
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for i, j := range jobs {
+			select {
+			case q.jobs <- j:
+			case <-q.quit:
+				for _, j := range jobs[i:] {
+					q.pending.Done()
+					q.release(j)
+				}
+				return
+			}
+		}
+	}()
+	return len(jobs)
+}
+
+// Wait blocks until every article enqueued so far has been processed
+func (q *Queue) Wait() {
+	q.pending.Wait()
+}
+
+// Stop tells the workers to exit, cancels the articles they are fetching
+// and waits for them to return. Cancelled articles stay pending and are
+// picked up again on the next start.
+func (q *Queue) Stop() {
+	close(q.quit)
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case j := <-q.jobs:
+			q.process(j)
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+func (q *Queue) process(j job) {
+	defer q.pending.Done()
+	defer q.release(j)
+
+	err := q.fetch(q.ctx, j)
+	if q.OnProcessed != nil {
+		q.OnProcessed(j.id, err)
+	}
+}
+
+func (q *Queue) fetch(ctx context.Context, j job) error {
+	// A sweep may have queued an article just as a worker finished it, and
+	// it may have been deleted while it waited
+	if !j.refresh {
+		if status, err := q.db.ArticleStatus(ctx, j.id); errors.Is(err, storage.ErrNotFound) || (err == nil && status != storage.StatusPending) {
+			return nil
+		}
+	}
+
+	page, err := parser.Fetch(ctx, j.url)
+	if err != nil {
+		log.Printf("ingest: article %d: %v", j.id, err)
+		if j.refresh || errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err := q.db.FailArticle(ctx, j.id, ErrorKind(err), err.Error()); err != nil {
+			log.Printf("ingest: article %d: failed to record error: %v", j.id, err)
+		}
+		return err
+	}
+
+	article := page.Article
+
+	// A page the user already has under another address, found through its
+	// canonical URL or text, is dropped in favor of the existing article
+	if !j.refresh {
+		existing, err := q.db.MergeDuplicate(ctx, j.id, article)
+		if err != nil {
+			log.Printf("ingest: article %d: failed to check for duplicates: %v", j.id, err)
+		} else if existing != 0 {
+			log.Printf("ingest: article %d is a duplicate of %d", j.id, existing)
+			return nil
+		}
+	}
+
+	// Keep local copies of images so the article survives offline and after
+	// the source site disappears
+	if err := assets.Archive(ctx, q.db, j.id, article); err != nil {
+		log.Printf("ingest: article %d: failed to archive images: %v", j.id, err)
+	}
+
+	if j.refresh {
+		changed, err := q.db.RefreshArticle(ctx, j.id, article)
+		if err != nil {
+			log.Printf("ingest: article %d: failed to save: %v", j.id, err)
+			return err
+		}
+		if !changed {
+			return nil
+		}
+	} else if err := q.db.CompleteArticle(ctx, j.id, article); err != nil {
+		log.Printf("ingest: article %d: failed to save: %v", j.id, err)
+		return err
+	}
+
+	if err := embed.IndexArticle(ctx, q.db, q.Embedder, j.id); err != nil {
+		log.Printf("ingest: article %d: failed to index: %v", j.id, err)
+	}
+
+	q.snapshot(ctx, j.id, page)
+
+	return nil
+}
+
+// snapshot stores copies of the whole page to fall back on when extraction
+// loses part of it. A PDF is kept as the original file and has no
+// single-file snapshot. Failures are logged; the article itself is already
+// saved.
+func (q *Queue) snapshot(ctx context.Context, id int64, page *parser.Page) {
+	raw := &storage.Snapshot{
+		Kind:      storage.SnapshotRaw,
+		URL:       page.URL.String(),
+		MediaType: page.ContentType,
+		Data:      page.Body,
+	}
+	if err := q.db.SaveSnapshot(ctx, id, raw); err != nil {
+		log.Printf("ingest: article %d: failed to save snapshot: %v", id, err)
+		return
+	}
+
+	if !q.SingleFile || page.Decoded == nil {
+		return
+	}
+	data, err := snapshot.SingleFile(ctx, page.Decoded, page.URL)
+	if err != nil {
+		log.Printf("ingest: article %d: failed to build single-file snapshot: %v", id, err)
+		return
+	}
+	single := &storage.Snapshot{
+		Kind:      storage.SnapshotSingleFile,
+		URL:       raw.URL,
+		MediaType: "text/html; charset=utf-8",
+		Data:      data,
+	}
+	if err := q.db.SaveSnapshot(ctx, id, single); err != nil {
+		log.Printf("ingest: article %d: failed to save snapshot: %v", id, err)
+	}
+}
@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/storage"
+)
+
+func TestEnqueueDoesNotBlockWhenFull(t *testing.T) {
+	q := New(nil, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for id := int64(1); id <= queueSize+10; id++ {
+			if !q.Enqueue(id, "https://example.com/") {
+				t.Errorf("Enqueue(%d) = false before Stop", id)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+
+	if len(q.jobs) != queueSize {
+		t.Errorf("%d jobs queued, want %d", len(q.jobs), queueSize)
+	}
+	// Articles that didn't fit are left for the sweep, not marked as queued
+	if q.queued[queueSize+1] {
+		t.Error("article that didn't fit is marked as queued")
+	}
+	if !q.queued[queueSize] {
+		t.Error("queued article isn't marked as queued")
+	}
+}
+
+func TestEnqueueSkipsQueuedArticles(t *testing.T) {
+	q := New(nil, 1)
+
+	q.Enqueue(1, "https://example.com/1")
+	q.Enqueue(1, "https://example.com/1")
+	q.EnqueueAll([]storage.Article{{ID: 1, URL: "https://example.com/1"}, {ID: 2, URL: "https://example.com/2"}})
+	// Refreshes are skipped while the article is queued, and queued once
+	if n := q.RefreshAll([]storage.Article{{ID: 1, URL: "https://example.com/1"}, {ID: 3, URL: "https://example.com/3"}}); n != 1 {
+		t.Errorf("RefreshAll queued %d articles, want 1", n)
+	}
+	if n := q.RefreshAll([]storage.Article{{ID: 3, URL: "https://example.com/3"}}); n != 0 {
+		t.Errorf("second RefreshAll queued %d articles, want 0", n)
+	}
+	// Nor is an article fetched twice at once
+	if err := q.Refresh(context.Background(), 3, "https://example.com/3"); !errors.Is(err, ErrQueued) {
+		t.Errorf("Refresh of a queued article: err = %v, want ErrQueued", err)
+	}
+	q.wg.Wait()
+
+	var got []string
+	for len(q.jobs) > 0 {
+		j := <-q.jobs
+		got = append(got, fmt.Sprint(j.id, j.refresh))
+	}
+	sort.Strings(got)
+	if want := "[1 false 2 false 3 true]"; fmt.Sprint(got) != want {
+		t.Errorf("jobs = %v, want %v", got, want)
+	}
+}
+
+func TestEnqueueAfterStop(t *testing.T) {
+	q := New(nil, 1)
+	q.Stop()
+
+	if q.Enqueue(1, "https://example.com/") {
+		t.Error("Enqueue = true after Stop")
+	}
+	if len(q.jobs) != 0 {
+		t.Errorf("%d jobs queued after Stop", len(q.jobs))
+	}
+}
+
+// newTestDB returns a migrated in-memory database with one user
+func newTestDB(t *testing.T) (*storage.SQLiteDB, int64) {
+	t.Helper()
+	db, err := storage.NewSQLiteDB(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	user, err := db.CreateUser(context.Background(), "alice", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, user.ID
+}
+
+// newHangingServer returns a server whose responses never come, and a
+// channel that receives each request as it arrives. Requests end when the
+// client gives up on them.
+func newHangingServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	fetch.AllowPrivate = true
+	t.Cleanup(func() { fetch.AllowPrivate = false })
+
+	started := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, started
+}
+
+func TestStopCancelsFetches(t *testing.T) {
+	ctx := context.Background()
+	db, user := newTestDB(t)
+	srv, started := newHangingServer(t)
+
+	id, err := db.CreateArticle(ctx, user, &storage.Article{URL: srv.URL + "/a", Status: storage.StatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := New(db, 1)
+	processed := make(chan error, 1)
+	q.OnProcessed = func(_ int64, err error) { processed <- err }
+	q.Start()
+	q.Enqueue(id, srv.URL+"/a")
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch didn't start")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop didn't cancel the fetch in flight")
+	}
+
+	if err := <-processed; !errors.Is(err, context.Canceled) {
+		t.Errorf("fetch error = %v, want context.Canceled", err)
+	}
+	// The article is fetched again on the next start rather than failed
+	status, err := db.ArticleStatus(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != storage.StatusPending {
+		t.Errorf("status = %s, want %s", status, storage.StatusPending)
+	}
+	pending, err := db.ListPendingArticles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != id {
+		t.Errorf("pending articles = %+v, want article %d", pending, id)
+	}
+}
+
+func TestRefreshCancelledKeepsArticle(t *testing.T) {
+	db, user := newTestDB(t)
+	srv, started := newHangingServer(t)
+
+	id, err := db.CreateArticle(context.Background(), user, &storage.Article{
+		URL: srv.URL + "/a", Title: "Kept", Content: "<p>Kept</p>", TextContent: "Kept",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := New(db, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if err := q.Refresh(ctx, id, srv.URL+"/a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Refresh: err = %v, want context.Canceled", err)
+	}
+
+	a, err := db.GetArticle(context.Background(), user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != storage.StatusReady || a.Title != "Kept" || a.Content != "<p>Kept</p>" {
+		t.Errorf("article = %s %q %q, want it unchanged", a.Status, a.Title, a.Content)
+	}
+	// The article can be refreshed again
+	if q.queued[id] {
+		t.Error("cancelled refresh left the article marked as queued")
+	}
+}
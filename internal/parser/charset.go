@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gogs/chardet"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// prescanSize is how far into a page a <meta> charset declaration is looked
+// for, as in browsers
+const prescanSize = 1024
+
+// byteOrderMarks identify Unicode pages regardless of what they declare
+var byteOrderMarks = []struct {
+	bom  []byte
+	enc  encoding.Encoding
+	name string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, unicode.UTF8BOM, "utf-8"},
+	{[]byte{0xFE, 0xFF}, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be"},
+	{[]byte{0xFF, 0xFE}, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le"},
+}
+
+// decode converts a page to UTF-8 and returns the name of the encoding it
+// was in. The encoding is taken from a byte order mark, the charset of the
+// Content-Type header or a <meta> declaration, in that order. Pages that
+// declare none are taken as UTF-8 if they are valid UTF-8, and are otherwise
+// detected from their bytes, falling back to Windows-1252.
+func decode(page []byte, contentType string) ([]byte, string, error) {
+	enc, name := declaredEncoding(page, contentType)
+	if enc == nil {
+		enc, name = detectEncoding(page)
+	}
+	if enc == encoding.Nop {
+		return page, name, nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(page)
+	if err != nil {
+		return nil, "", err
+	}
+	return decoded, name, nil
+}
+
+// declaredEncoding returns the encoding a page declares, or nil. Encodings
+// that are already UTF-8 are returned as encoding.Nop.
+func declaredEncoding(page []byte, contentType string) (encoding.Encoding, string) {
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(page, b.bom) {
+			return b.enc, b.name
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if enc, name := lookup(params["charset"]); enc != nil {
+			return enc, name
+		}
+	}
+
+	if enc, name := lookup(metaCharset(page)); enc != nil {
+		// A page that was read as ASCII can't really be UTF-16
+		if strings.HasPrefix(name, "utf-16") {
+			return encoding.Nop, "utf-8"
+		}
+		return enc, name
+	}
+	return nil, ""
+}
+
+// detectEncoding guesses the encoding of a page that doesn't declare one
+func detectEncoding(page []byte) (encoding.Encoding, string) {
+	if utf8.Valid(page) {
+		return encoding.Nop, "utf-8"
+	}
+
+	if result, err := chardet.NewHtmlDetector().DetectBest(page); err == nil {
+		if enc, name := lookup(result.Charset); enc != nil && enc != encoding.Nop {
+			return enc, name
+		}
+	}
+	return charmap.Windows1252, "windows-1252"
+}
+
+// lookup finds an encoding by any of its WHATWG labels, so "latin1" and
+// "iso-8859-1" are both Windows-1252 as in browsers. UTF-8 is returned as
+// encoding.Nop.
+func lookup(label string) (encoding.Encoding, string) {
+	if label == "" {
+		return nil, ""
+	}
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return nil, ""
+	}
+	if name == "utf-8" {
+		return encoding.Nop, name
+	}
+	return enc, name
+}
+
+// metaCharset returns the charset named by a <meta charset> or <meta
+// http-equiv="Content-Type"> near the top of a page, or ""
+func metaCharset(page []byte) string {
+	if len(page) > prescanSize {
+		page = page[:prescanSize]
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom != atom.Meta {
+				continue
+			}
+			if cs := attr(t, "charset"); cs != "" {
+				return strings.TrimSpace(cs)
+			}
+			if strings.EqualFold(attr(t, "http-equiv"), "content-type") {
+				if _, params, err := mime.ParseMediaType(attr(t, "content")); err == nil && params["charset"] != "" {
+					return params["charset"]
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDecodeFixtures(t *testing.T) {
+	pages := []struct {
+		file    string
+		charset string
+		name    string
+		want    []string
+	}{
+		{"shift_jis", "Shift_JIS", "shift_jis", []string{"吾輩は猫である", "名前はまだ無い"}},
+		{"koi8-r", "KOI8-R", "koi8-r", []string{"Война и мир", "Генуя и Лукка"}},
+		{"latin1", "ISO-8859-1", "windows-1252", []string{"Café crème à la française", "« Voilà »"}},
+	}
+
+	for _, p := range pages {
+		cases := []struct {
+			label       string
+			file        string
+			contentType string
+		}{
+			{"header", p.file + ".html", "text/html; charset=" + p.charset},
+			{"meta", p.file + "-meta.html", "text/html"},
+			{"undeclared", p.file + ".html", "text/html"},
+		}
+		for _, c := range cases {
+			t.Run(p.file+"/"+c.label, func(t *testing.T) {
+				page, err := os.ReadFile(filepath.Join("testdata", c.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, name, err := decode(page, c.contentType)
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if name != p.name {
+					t.Errorf("encoding = %q, want %q", name, p.name)
+				}
+				if !utf8.Valid(got) {
+					t.Fatal("decoded page is not valid UTF-8")
+				}
+				for _, want := range p.want {
+					if !strings.Contains(string(got), want) {
+						t.Errorf("decoded page does not contain %q", want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeByteOrderMark(t *testing.T) {
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("<p>Grüße</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		page        string
+		contentType string
+		want        string
+		wantName    string
+	}{
+		{"utf-8 over header", "\xEF\xBB\xBF<p>Grüße</p>", "text/html; charset=koi8-r", "<p>Grüße</p>", "utf-8"},
+		{"utf-16 over meta", utf16, "text/html", "<p>Grüße</p>", "utf-16le"},
+		{"utf-16 over header", utf16, "text/html; charset=windows-1252", "<p>Grüße</p>", "utf-16le"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, name, err := decode([]byte(tt.page), tt.contentType)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if string(got) != tt.want || name != tt.wantName {
+				t.Errorf("decode = %q, %q; want %q, %q", got, name, tt.want, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestDeclaredEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        string
+		contentType string
+		want        string
+		nop         bool
+	}{
+		{"none", "<p>hi</p>", "text/html", "", false},
+		{"header", "<p>hi</p>", "text/html; charset=KOI8-R", "koi8-r", false},
+		{"header utf-8", "<p>hi</p>", "text/html; charset=utf-8", "utf-8", true},
+		{"header over meta", `<meta charset="shift_jis">`, "text/html; charset=koi8-r", "koi8-r", false},
+		{"unknown header falls back to meta", `<meta charset="shift_jis">`, "text/html; charset=bogus", "shift_jis", false},
+		{"meta charset", `<head><meta charset="latin1">`, "", "windows-1252", false},
+		{"meta http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=koi8-r">`, "", "koi8-r", false},
+		{"meta utf-16 is utf-8", `<meta charset="utf-16">`, "", "utf-8", true},
+		{"meta utf-16le is utf-8", `<meta http-equiv="content-type" content="text/html; charset=UTF-16LE">`, "", "utf-8", true},
+		{"meta past prescan", strings.Repeat(" ", prescanSize) + `<meta charset="koi8-r">`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, name := declaredEncoding([]byte(tt.page), tt.contentType)
+			if name != tt.want {
+				t.Errorf("name = %q, want %q", name, tt.want)
+			}
+			if tt.want == "" && enc != nil {
+				t.Errorf("encoding = %v, want nil", enc)
+			}
+			if (enc == encoding.Nop) != tt.nop {
+				t.Errorf("encoding is Nop = %v, want %v", enc == encoding.Nop, tt.nop)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"sync"
+
+	readability "github.com/go-shiori/go-readability"
+	"golang.org/x/net/html"
+	"pocket-clone/internal/storage"
+)
+
+// Extractor pulls the article out of a fetched page, which has been
+// converted to UTF-8. It fills in the title, content, text, excerpt,
+// author, image and published time it finds; Fetch fills in the rest.
+type Extractor interface {
+	// Name is recorded on articles the extractor produced
+	Name() string
+	Extract(page []byte, pageURL *url.URL) (*storage.Article, error)
+}
+
+// Readability extracts articles with go-readability's generic heuristics.
+// It is the fallback for sites without an extractor of their own.
+type Readability struct{}
+
+func (Readability) Name() string {
+	return "readability"
+}
+
+func (Readability) Extract(page []byte, pageURL *url.URL) (*storage.Article, error) {
+	// Parse the page ourselves: readability.FromReader guesses the encoding
+	// again and can take UTF-8 with few non-ASCII characters for Latin-1
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	article, err := readability.FromDocument(doc, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	content, err := Sanitize(article.Content, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	image, _ := safeURL(article.Image, pageURL)
+
+	return &storage.Article{
+		Title:       article.Title,
+		Content:     content,
+		TextContent: article.TextContent,
+		Excerpt:     article.Excerpt,
+		Author:      article.Byline,
+		ImageURL:    image,
+		PublishedAt: article.PublishedTime,
+	}, nil
+}
+
+// Registry picks the extractor for a page by its host
+type Registry struct {
+	mu       sync.RWMutex
+	patterns map[string]Extractor
+	fallback Extractor
+}
+
+// NewRegistry returns a registry that uses fallback for hosts without an
+// extractor
+func NewRegistry(fallback Extractor) *Registry {
+	return &Registry{patterns: make(map[string]Extractor), fallback: fallback}
+}
+
+// Extractors is the registry Fetch uses. Sites without an extractor of
+// their own use Readability.
+var Extractors = NewRegistry(Readability{})
+
+// Register sets the extractor for a host pattern, replacing any earlier one.
+// A pattern is a host name and matches its subdomains as well, so
+// "example.com" covers www.example.com and blog.example.com.
+func (r *Registry) Register(pattern string, e Extractor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns[normalizeHost(pattern)] = e
+}
+
+// For returns the extractor for a host: the one registered for the host
+// itself or, failing that, for the closest parent domain, or the fallback
+func (r *Registry) For(host string) Extractor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	host = normalizeHost(host)
+	for host != "" {
+		if e, ok := r.patterns[host]; ok {
+			return e
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return r.fallback
+}
+
+// Extract runs the extractor for a page's host, falling back to the
+// registry's fallback if it fails, and records which extractor produced
+// the article
+func (r *Registry) Extract(page []byte, pageURL *url.URL) (*storage.Article, error) {
+	e := r.For(pageURL.Hostname())
+	article, err := e.Extract(page, pageURL)
+	if err != nil && e != r.fallback {
+		e = r.fallback
+		article, err = e.Extract(page, pageURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	article.Extractor = e.Name()
+	return article, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"pocket-clone/internal/storage"
+)
+
+// MediaTypePDF is the media type of PDF documents, which are saved with
+// the PDF extractor instead of the page extractors
+const MediaTypePDF = "application/pdf"
+
+// maxPDFPages caps how many pages of a document are read
+const maxPDFPages = 500
+
+// PDF extracts the text of PDF documents. The title and author come from
+// the document's metadata, or else the title is the largest text on the
+// first page. The reading view is the text split into paragraphs; documents
+// without a text layer, such as scans, have none.
+type PDF struct{}
+
+func (PDF) Name() string {
+	return "pdf"
+}
+
+// Extract reads a PDF. The PDF library panics on some malformed files, which
+// is reported as an error.
+func (PDF) Extract(data []byte, docURL *url.URL) (article *storage.Article, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			article, err = nil, fmt.Errorf("reading PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading PDF: %w", err)
+	}
+
+	var paragraphs []string
+	var heading string
+	for i := 1; i <= r.NumPage() && i <= maxPDFPages; i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		lines := textLines(page.Content().Text)
+		if i == 1 {
+			heading = largestLine(lines)
+		}
+		paragraphs = append(paragraphs, joinParagraphs(lines)...)
+	}
+
+	info := r.Trailer().Key("Info")
+	article = &storage.Article{
+		Title:  strings.TrimSpace(info.Key("Title").Text()),
+		Author: strings.TrimSpace(info.Key("Author").Text()),
+	}
+	if article.Title == "" {
+		article.Title = heading
+	}
+	if article.Title == "" {
+		article.Title = strings.TrimSuffix(path.Base(docURL.Path), path.Ext(docURL.Path))
+	}
+	if t, ok := parsePDFDate(info.Key("CreationDate").Text()); ok {
+		article.PublishedAt = &t
+	}
+
+	var content strings.Builder
+	for _, p := range paragraphs {
+		content.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+	}
+	article.Content = content.String()
+	article.TextContent = strings.Join(paragraphs, "\n")
+	return article, nil
+}
+
+// textLine is a line of text on a page
+type textLine struct {
+	text     string
+	y        float64
+	fontSize float64
+}
+
+// textLines assembles a page's characters, which the PDF library returns
+// one by one in drawing order, into lines. Words are split where there is a
+// gap between characters.
+func textLines(chars []pdf.Text) []textLine {
+	var lines []textLine
+	var sb strings.Builder
+	var cur *textLine
+	var end float64
+
+	flush := func() {
+		if cur != nil {
+			if text := strings.Join(strings.Fields(sb.String()), " "); text != "" {
+				cur.text = text
+				lines = append(lines, *cur)
+			}
+		}
+		sb.Reset()
+		cur = nil
+	}
+
+	for _, c := range chars {
+		size := math.Max(c.FontSize, 1)
+		if cur != nil && math.Abs(c.Y-cur.y) > size/2 {
+			flush()
+		}
+		if cur == nil {
+			cur = &textLine{y: c.Y, fontSize: size}
+		} else if c.X > end+size*0.15 || c.X < end-size {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(c.S)
+		cur.fontSize = math.Max(cur.fontSize, size)
+		end = c.X + c.W
+	}
+	flush()
+	return lines
+}
+
+// largestLine returns the text of the first line set in the largest font,
+// which is usually the title
+func largestLine(lines []textLine) string {
+	best := -1
+	for i, l := range lines {
+		if best < 0 || l.fontSize > lines[best].fontSize {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return lines[best].text
+}
+
+// joinParagraphs joins a page's lines into paragraphs, which are split where
+// the space between lines is wider than usual or the font size changes.
+// Words hyphenated across lines are joined up again.
+func joinParagraphs(lines []textLine) []string {
+	var paragraphs []string
+	var sb strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			gap := prev.y - l.y
+			if gap > prev.fontSize*1.8 || gap < 0 || math.Abs(l.fontSize-prev.fontSize) > 1 {
+				paragraphs = append(paragraphs, sb.String())
+				sb.Reset()
+			}
+		}
+
+		if sb.Len() == 0 {
+			sb.WriteString(l.text)
+			continue
+		}
+		text := sb.String()
+		first, _ := utf8.DecodeRuneInString(l.text)
+		if strings.HasSuffix(text, "-") && unicode.IsLower(first) {
+			sb.Reset()
+			sb.WriteString(strings.TrimSuffix(text, "-"))
+		} else {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(l.text)
+	}
+	if sb.Len() > 0 {
+		paragraphs = append(paragraphs, sb.String())
+	}
+	return paragraphs
+}
+
+// parsePDFDate parses a PDF date such as D:20240131093000+01'00'. Everything
+// after the year is optional.
+func parsePDFDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 || digits%2 != 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102150405"[:digits], s[:digits])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The zone is Z, or an offset written +HH'mm'
+	zone := strings.ReplaceAll(s[digits:], "'", "")
+	if len(zone) == 3 {
+		zone += "00"
+	}
+	if z, err := time.Parse("-0700", zone); err == nil {
+		_, offset := z.Zone()
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", offset))
+	}
+	return t, true
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // RFC 3339, or "" for no date
+	}{
+		{"D:20240131093000+01'00'", "2024-01-31T09:30:00+01:00"},
+		{"D:20240131093000-05'30", "2024-01-31T09:30:00-05:30"},
+		{"D:20240131093000Z", "2024-01-31T09:30:00Z"},
+		{"D:20240131093000Z00'00'", "2024-01-31T09:30:00Z"},
+		{"D:20240131093000", "2024-01-31T09:30:00Z"},
+		{"20240131093000+02", "2024-01-31T09:30:00+02:00"},
+		{"D:202401310930", "2024-01-31T09:30:00Z"},
+		{"D:2024", "2024-01-01T00:00:00Z"},
+		{"  D:20240131  ", "2024-01-31T00:00:00Z"},
+		{"D:202", ""},
+		{"D:20241", ""},
+		{"D:20241331", ""},
+		{"", ""},
+		{"yesterday", ""},
+	}
+	for _, tt := range tests {
+		got, ok := parsePDFDate(tt.in)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("parsePDFDate(%q) = %v, want no date", tt.in, got)
+			}
+			continue
+		}
+		if !ok || got.Format(time.RFC3339) != tt.want {
+			t.Errorf("parsePDFDate(%q) = %v, %v, want %s", tt.in, got.Format(time.RFC3339), ok, tt.want)
+		}
+	}
+}
+
+// word returns the characters of s drawn one by one from x on a line at y
+func word(s string, x, y, size float64) []pdf.Text {
+	var chars []pdf.Text
+	w := size / 2
+	for _, r := range s {
+		chars = append(chars, pdf.Text{FontSize: size, X: x, Y: y, W: w, S: string(r)})
+		x += w
+	}
+	return chars
+}
+
+// line draws words at y with a space's width between them
+func line(y, size float64, words ...string) []pdf.Text {
+	var chars []pdf.Text
+	x := 72.0
+	for _, w := range words {
+		chars = append(chars, word(w, x, y, size)...)
+		x += float64(len([]rune(w)))*size/2 + size/2
+	}
+	return chars
+}
+
+func concat(parts ...[]pdf.Text) []pdf.Text {
+	var all []pdf.Text
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
+
+func TestTextLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		chars []pdf.Text
+		want  string
+	}{
+		{"one line", line(700, 10, "Hello", "world"), `[{"Hello world" 700 10}]`},
+		{"two lines", concat(line(700, 10, "first"), line(688, 10, "second")), `[{"first" 700 10} {"second" 688 10}]`},
+		{"baseline jitter", concat(word("ab", 72, 700, 10), word("cd", 82, 701, 10)), `[{"abcd" 700 10}]`},
+		{"tight kerning", concat(word("a", 72, 700, 10), word("b", 76.5, 700, 10)), `[{"ab" 700 10}]`},
+		{"line restarts to the left", concat(word("end", 300, 700, 10), word("col", 72, 700, 10)), `[{"end col" 700 10}]`},
+		{"largest font on the line", concat(word("A", 72, 700, 18), word("b", 81, 700, 10)), `[{"Ab" 700 18}]`},
+		{"blank characters", concat(line(700, 10, "x"), line(688, 10, " ", " ")), `[{"x" 700 10}]`},
+		{"no characters", nil, `[]`},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, l := range textLines(tt.chars) {
+			got = append(got, fmt.Sprintf("{%q %g %g}", l.text, l.y, l.fontSize))
+		}
+		if s := fmt.Sprint(got); s != tt.want {
+			t.Errorf("%s: textLines = %s, want %s", tt.name, s, tt.want)
+		}
+	}
+}
+
+func TestLargestLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []textLine
+		want  string
+	}{
+		{"title", []textLine{{"Journal", 760, 9}, {"The Title", 700, 20}, {"Body", 660, 10}}, "The Title"},
+		{"first of equal sizes", []textLine{{"One", 700, 12}, {"Two", 680, 12}}, "One"},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := largestLine(tt.lines); got != tt.want {
+			t.Errorf("%s: largestLine = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJoinParagraphs(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []textLine
+		want  []string
+	}{
+		{
+			"lines of a paragraph",
+			[]textLine{{"The first", 700, 10}, {"paragraph.", 688, 10}},
+			[]string{"The first paragraph."},
+		},
+		{
+			"wide gap",
+			[]textLine{{"One.", 700, 10}, {"Two.", 670, 10}},
+			[]string{"One.", "Two."},
+		},
+		{
+			"font size change",
+			[]textLine{{"Heading", 700, 14}, {"Body text", 684, 10}},
+			[]string{"Heading", "Body text"},
+		},
+		{
+			"new column",
+			[]textLine{{"Bottom of column.", 80, 10}, {"Top of next.", 700, 10}},
+			[]string{"Bottom of column.", "Top of next."},
+		},
+		{
+			"hyphenated word",
+			[]textLine{{"an extra-", 700, 10}, {"ordinary case", 688, 10}},
+			[]string{"an extraordinary case"},
+		},
+		{
+			"hyphen before a capital is kept",
+			[]textLine{{"the Austro-", 700, 10}, {"Hungarian empire", 688, 10}},
+			[]string{"the Austro- Hungarian empire"},
+		},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := joinParagraphs(tt.lines); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%s: joinParagraphs = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
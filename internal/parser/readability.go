@@ -1,69 +1,174 @@
 package parser
 
 import (
-	"net/http"
+	"bytes"
+	"context"
+	"errors"
+	"mime"
 	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	readability "github.com/go-shiori/go-readability"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"pocket-clone/internal/canonical"
+	"pocket-clone/internal/fetch"
 	"pocket-clone/internal/storage"
 )
 
-var httpClient = &http.Client{
-	Timeout: 30 * time.Second,
-}
+// NormalizeURL validates a user-supplied URL, defaults its scheme to https
+// and strips tracking parameters and the fragment
+func NormalizeURL(articleURL string) (string, error) {
+	articleURL = strings.TrimSpace(articleURL)
+	if !strings.Contains(articleURL, "://") {
+		articleURL = "https://" + articleURL
+	}
 
-// Parse fetches a URL and extracts the article content
-func Parse(articleURL string) (*storage.Article, error) {
-	// Validate URL
 	parsedURL, err := url.Parse(articleURL)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return "", errors.New("not an http(s) URL")
 	}
 
-	// Ensure scheme
-	if parsedURL.Scheme == "" {
-		parsedURL.Scheme = "https"
-		articleURL = parsedURL.String()
+	canonical.Clean(parsedURL)
+	return parsedURL.String(), nil
+}
+
+// maxPageSize caps the size of a page
+const maxPageSize = 20 << 20
+
+// pageFetcher downloads pages. Anything but HTML or a PDF, such as an
+// image, is refused.
+var pageFetcher = fetch.New(maxPageSize, "text/html", "application/xhtml+xml", MediaTypePDF)
+
+// Page is a fetched web page or PDF and the article extracted from it
+type Page struct {
+	Article *storage.Article
+	// Body is the page or PDF as it was served, kept for snapshots
+	Body []byte
+	// ContentType is the media type the page was served with, with the
+	// charset a web page was decoded from
+	ContentType string
+	// Decoded is a web page converted to UTF-8, or nil for a PDF
+	Decoded []byte
+	// URL is the page's address after redirects
+	URL *url.URL
+}
+
+// Fetch downloads a page and extracts the article content, keeping the
+// page's HTML. Web pages are converted to UTF-8 before extraction; PDFs are
+// read with the PDF extractor. Cancelling ctx stops the download. Errors
+// from downloading the page are fetch's typed errors.
+func Fetch(ctx context.Context, articleURL string) (*Page, error) {
+	articleURL, err := NormalizeURL(articleURL)
+	if err != nil {
+		return nil, err
 	}
 
 	// Fetch the page
-	resp, err := httpClient.Get(articleURL)
+	resp, err := pageFetcher.Get(ctx, articleURL)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	page := &Page{Body: resp.Body, ContentType: resp.MediaType, URL: resp.URL}
 
-	// Parse with readability
-	article, err := readability.FromReader(resp.Body, parsedURL)
+	// Extract the article, resolving links against the final URL
+	var article *storage.Article
+	if resp.MediaType == MediaTypePDF {
+		article, err = PDF{}.Extract(resp.Body, resp.URL)
+		if err == nil {
+			article.Extractor = PDF{}.Name()
+		}
+	} else {
+		var charset string
+		page.Decoded, charset, err = decode(resp.Body, resp.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		page.ContentType = mime.FormatMediaType(resp.MediaType, map[string]string{"charset": charset})
+		article, err = Extractors.Extract(page.Decoded, resp.URL)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Extract plain text for search
-	textContent := extractText(article.TextContent)
+	article.TextContent = extractText(article.TextContent)
 
 	// Create excerpt if not provided
-	excerpt := article.Excerpt
-	if excerpt == "" && len(textContent) > 0 {
-		if len(textContent) > 200 {
-			excerpt = textContent[:200] + "..."
+	if article.Excerpt == "" && len(article.TextContent) > 0 {
+		if len(article.TextContent) > 200 {
+			// Cut at a character boundary so multi-byte text stays valid
+			cut := 200
+			for cut > 0 && !utf8.RuneStart(article.TextContent[cut]) {
+				cut--
+			}
+			article.Excerpt = article.TextContent[:cut] + "..."
 		} else {
-			excerpt = textContent
+			article.Excerpt = article.TextContent
 		}
 	}
 
-	return &storage.Article{
-		URL:         articleURL,
-		Title:       article.Title,
-		Content:     article.Content,
-		TextContent: textContent,
-		Excerpt:     excerpt,
-		Author:      article.Byline,
-		ImageURL:    article.Image,
-		SavedAt:     time.Now(),
-	}, nil
+	article.URL = articleURL
+	if page.Decoded != nil {
+		article.CanonicalURL = canonicalURL(page.Decoded, resp.URL)
+	}
+	article.SavedAt = time.Now()
+
+	page.Article = article
+	return page, nil
+}
+
+// canonicalURL returns the address a page names as its canonical one with
+// <link rel="canonical">, such as the regular version of an AMP page, or ""
+func canonicalURL(page []byte, base *url.URL) string {
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom == atom.Body {
+				return ""
+			}
+			if t.DataAtom != atom.Link || !hasToken(attr(t, "rel"), "canonical") {
+				continue
+			}
+			ref, err := url.Parse(strings.TrimSpace(attr(t, "href")))
+			if err != nil {
+				return ""
+			}
+			normalized, err := NormalizeURL(base.ResolveReference(ref).String())
+			if err != nil {
+				return ""
+			}
+			return normalized
+		}
+	}
+}
+
+func attr(t html.Token, name string) string {
+	for _, a := range t.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space-separated attribute value contains a
+// token, ignoring case
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
 }
 
 // extractText cleans up text content
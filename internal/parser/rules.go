@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"pocket-clone/internal/storage"
+)
+
+// ErrNoMatch is returned by a site rule whose body selectors match nothing
+// on a page, such as after the site changed its layout
+var ErrNoMatch = errors.New("site rule matched no content")
+
+// SiteRule is a declarative extractor for one site. Rules are written in the
+// spirit of FiveFilters' ftr-site-config files, with CSS selectors in place
+// of XPath:
+//
+//	# Comments start with #
+//	title: h1.headline
+//	body: div.article-body
+//	body: article
+//	author: .byline a
+//	date: time[datetime]
+//	strip: aside, .related
+//	strip_id_or_class: newsletter
+//
+// A directive can be repeated: title, body, author and date selectors are
+// tried in order until one matches, and every strip applies. Elements
+// matched by strip, and those whose id or class contains a
+// strip_id_or_class value, are removed before anything is extracted. Other
+// ftr-site-config directives are ignored.
+type SiteRule struct {
+	name   string
+	title  []cascadia.Selector
+	body   []cascadia.Selector
+	author []cascadia.Selector
+	date   []cascadia.Selector
+	strip  []cascadia.Selector
+}
+
+// ParseSiteRule reads a rule. name identifies it on the articles it
+// extracts.
+func ParseSiteRule(name string, r io.Reader) (*SiteRule, error) {
+	rule := &SiteRule{name: name}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		directive, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected directive: value", line)
+		}
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		value = strings.TrimSpace(value)
+
+		var list *[]cascadia.Selector
+		switch directive {
+		case "title":
+			list = &rule.title
+		case "body":
+			list = &rule.body
+		case "author":
+			list = &rule.author
+		case "date":
+			list = &rule.date
+		case "strip":
+			list = &rule.strip
+		case "strip_id_or_class":
+			value = fmt.Sprintf("[id*=%s], [class*=%s]", cssString(value), cssString(value))
+			list = &rule.strip
+		default:
+			continue
+		}
+
+		sel, err := cascadia.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, directive, err)
+		}
+		*list = append(*list, sel)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rule.body) == 0 {
+		return nil, errors.New("no body selector")
+	}
+	return rule, nil
+}
+
+// cssString quotes s as a CSS string. Quotes and backslashes are escaped
+// with a backslash and control characters by their code point; everything
+// else, including non-ASCII text, can appear in a CSS string as it is.
+func cssString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, "\\%x ", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// LoadSiteRules registers a rule for every .txt file in dir with reg. A
+// file's name without the extension is its host pattern, so example.com.txt
+// applies to example.com and its subdomains. The leading dot of the
+// wildcard names ftr uses, such as .example.com.txt, is dropped, so they
+// apply the same way. It returns how many rules were loaded; a file that
+// can't be parsed is an error naming it.
+func LoadSiteRules(dir string, reg *Registry) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range paths {
+		pattern := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), ".txt"), ".")
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		rule, err := ParseSiteRule("rule:"+pattern, f)
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		reg.Register(pattern, rule)
+	}
+	return len(paths), nil
+}
+
+func (r *SiteRule) Name() string {
+	return r.name
+}
+
+// Extract applies the rule to a page. Metadata the rule has no selectors
+// for, or whose selectors match nothing, is taken from the page's meta
+// tags.
+func (r *SiteRule) Extract(page []byte, pageURL *url.URL) (*storage.Article, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sel := range r.strip {
+		for _, n := range sel.MatchAll(doc) {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+
+	var body []*html.Node
+	for _, sel := range r.body {
+		if body = outermost(sel.MatchAll(doc)); len(body) > 0 {
+			break
+		}
+	}
+	if len(body) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	meta := pageMeta(doc)
+	article := &storage.Article{
+		Title:   firstText(doc, r.title),
+		Excerpt: meta["description"],
+		Author:  firstText(doc, r.author),
+	}
+	if image, ok := safeURL(meta["image"], pageURL); ok {
+		article.ImageURL = image
+	}
+	if article.Title == "" {
+		article.Title = meta["title"]
+	}
+	if article.Author == "" {
+		article.Author = meta["author"]
+	}
+	if t, ok := parseDate(firstDate(doc, r.date)); ok {
+		article.PublishedAt = &t
+	} else if t, ok := parseDate(meta["published"]); ok {
+		article.PublishedAt = &t
+	}
+
+	// The body is moved out of the page to be sanitized, so it goes last
+	container := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, n := range body {
+		n.Parent.RemoveChild(n)
+		container.AppendChild(n)
+	}
+	if article.Content, err = renderSanitized(container, pageURL); err != nil {
+		return nil, err
+	}
+	if article.TextContent, err = TextFromHTML(article.Content); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// outermost drops nodes that are inside another node of the list
+func outermost(nodes []*html.Node) []*html.Node {
+	inList := make(map[*html.Node]bool, len(nodes))
+	for _, n := range nodes {
+		inList[n] = true
+	}
+
+	var result []*html.Node
+	for _, n := range nodes {
+		nested := false
+		for p := n.Parent; p != nil; p = p.Parent {
+			if inList[p] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// firstText returns the text of the first element matched by the first
+// selector that matches anything
+func firstText(doc *html.Node, sels []cascadia.Selector) string {
+	for _, sel := range sels {
+		if n := sel.MatchFirst(doc); n != nil {
+			if text := strings.Join(strings.Fields(nodeText(n)), " "); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// firstDate is like firstText but prefers a machine-readable datetime or
+// content attribute, as on <time> and <meta>
+func firstDate(doc *html.Node, sels []cascadia.Selector) string {
+	for _, sel := range sels {
+		n := sel.MatchFirst(doc)
+		if n == nil {
+			continue
+		}
+		for _, a := range n.Attr {
+			if (a.Key == "datetime" || a.Key == "content") && a.Val != "" {
+				return a.Val
+			}
+		}
+		if text := strings.TrimSpace(nodeText(n)); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+	return sb.String()
+}
+
+// pageMeta collects a page's title, description, author, image and
+// published time from its <title> and OpenGraph and article meta tags
+func pageMeta(doc *html.Node) map[string]string {
+	keys := map[string]string{
+		"og:title":               "title",
+		"description":            "description",
+		"og:description":         "description",
+		"author":                 "author",
+		"article:author":         "author",
+		"og:image":               "image",
+		"article:published_time": "published",
+	}
+
+	meta := make(map[string]string)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if meta["title"] == "" {
+					meta["title"] = strings.TrimSpace(nodeText(n))
+				}
+			case atom.Meta:
+				name, content := "", ""
+				for _, a := range n.Attr {
+					switch a.Key {
+					case "name", "property":
+						name = strings.ToLower(a.Val)
+					case "content":
+						content = strings.TrimSpace(a.Val)
+					}
+				}
+				// Meta tags win over <title>, which often has the site name
+				if key, ok := keys[name]; ok && content != "" {
+					meta[key] = content
+				}
+			case atom.Body:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return meta
+}
+
+// dateLayouts are the formats published dates are commonly written in
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,286 @@
+package parser
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pocket-clone/internal/storage"
+)
+
+const testRule = `# Example News
+title: h1.headline
+body: div.missing
+body: div.article-body
+author: .byline a
+date: time[datetime]
+strip: aside, .related
+strip_id_or_class: newsletter
+single_page_link: a.all
+`
+
+const testPage = `<html><head>
+<title>Example News | Site</title>
+<meta name="description" content="An excerpt">
+</head><body>
+<h1 class="headline">The headline</h1>
+<p class="byline">By <a href="/jane">Jane Doe</a></p>
+<time datetime="2024-03-01T12:00:00Z">March 1</time>
+<div class="article-body">
+<p>The article text.</p>
+<aside>An aside</aside>
+<div class="signup-newsletter-box">Subscribe</div>
+<p class="related">Related links</p>
+</div>
+</body></html>`
+
+func TestParseSiteRule(t *testing.T) {
+	rule, err := ParseSiteRule("rule:example.com", strings.NewReader(testRule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rule.title) != 1 || len(rule.body) != 2 || len(rule.author) != 1 || len(rule.date) != 1 || len(rule.strip) != 2 {
+		t.Errorf("selectors: %d title, %d body, %d author, %d date, %d strip; want 1, 2, 1, 1, 2",
+			len(rule.title), len(rule.body), len(rule.author), len(rule.date), len(rule.strip))
+	}
+
+	pageURL, _ := url.Parse("https://example.com/news/1")
+	article, err := rule.Extract([]byte(testPage), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "The headline" {
+		t.Errorf("Title = %q", article.Title)
+	}
+	if article.Author != "Jane Doe" {
+		t.Errorf("Author = %q", article.Author)
+	}
+	if article.Excerpt != "An excerpt" {
+		t.Errorf("Excerpt = %q", article.Excerpt)
+	}
+	if article.PublishedAt == nil || article.PublishedAt.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("PublishedAt = %v", article.PublishedAt)
+	}
+	if text := strings.TrimSpace(article.TextContent); text != "The article text." {
+		t.Errorf("TextContent = %q, want only the article text", text)
+	}
+}
+
+func TestParseSiteRuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"no body", "title: h1\n"},
+		{"only comments", "# body: article\n"},
+		{"missing colon", "body article\n"},
+		{"bad selector", "body: div[\n"},
+		{"bad strip selector", "body: article\nstrip: ::nope(\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSiteRule("rule:test", strings.NewReader(tt.rule)); err == nil {
+				t.Error("ParseSiteRule succeeded")
+			}
+		})
+	}
+}
+
+func TestStripIDOrClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		attr  string
+	}{
+		{"plain", "promo", `class="top-promo"`},
+		{"quote", `say"hi`, `id="x-say&quot;hi-y"`},
+		{"backslash", `a\b`, `class="a\b"`},
+		{"non-ASCII", "werbung-ü", `class="box werbung-ü"`},
+		{"CJK", "広告", `id="広告枠"`},
+		{"zero-width space", "ad\u200bbox", "class=\"ad\u200bbox\""},
+		{"soft hyphen", "pro\u00admo", "class=\"pro\u00admo\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseSiteRule("rule:test", strings.NewReader("body: article\nstrip_id_or_class: "+tt.value+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			page := `<article><p>kept</p><div ` + tt.attr + `>stripped</div><div class="other">also kept</div></article>`
+			article, err := rule.Extract([]byte(page), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(article.Content, "stripped") {
+				t.Errorf("element with %s was kept: %s", tt.attr, article.Content)
+			}
+			if !strings.Contains(article.Content, "also kept") {
+				t.Errorf("unrelated element was stripped: %s", article.Content)
+			}
+		})
+	}
+}
+
+func TestCSSString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"promo", `"promo"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"ü広告", `"ü広告"`},
+		{"a\nb", `"a\a b"`},
+	}
+	for _, tt := range tests {
+		if got := cssString(tt.in); got != tt.want {
+			t.Errorf("cssString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSiteRules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"example.com.txt":      "body: article\n",
+		"news.example.org.txt": "body: main\n",
+		".wildcard.net.txt":    "body: div\n",
+		"notes.md":             "not a rule",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg := NewRegistry(Readability{})
+	n, err := LoadSiteRules(dir, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("loaded %d rules, want 3", n)
+	}
+	if got := reg.For("www.example.com").Name(); got != "rule:example.com" {
+		t.Errorf("For(www.example.com) = %s", got)
+	}
+	if got := reg.For("news.example.org").Name(); got != "rule:news.example.org" {
+		t.Errorf("For(news.example.org) = %s", got)
+	}
+	if got := reg.For("blog.wildcard.net").Name(); got != "rule:wildcard.net" {
+		t.Errorf("For(blog.wildcard.net) = %s", got)
+	}
+
+	// A broken rule is an error naming its file
+	bad := filepath.Join(dir, "broken.net.txt")
+	if err := os.WriteFile(bad, []byte("title: h1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSiteRules(dir, NewRegistry(Readability{})); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("err = %v, want one naming %s", err, bad)
+	}
+}
+
+// namedExtractor is an extractor that returns a fixed result
+type namedExtractor struct {
+	name string
+	err  error
+}
+
+func (e namedExtractor) Name() string {
+	return e.name
+}
+
+func (e namedExtractor) Extract(page []byte, pageURL *url.URL) (*storage.Article, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &storage.Article{Title: e.name}, nil
+}
+
+func TestRegistryFor(t *testing.T) {
+	reg := NewRegistry(namedExtractor{name: "fallback"})
+	reg.Register("example.com", namedExtractor{name: "example"})
+	reg.Register("Blog.Example.com.", namedExtractor{name: "blog"})
+	reg.Register("co.uk", namedExtractor{name: "co.uk"})
+
+	tests := []struct {
+		host, want string
+	}{
+		{"example.com", "example"},
+		{"EXAMPLE.COM", "example"},
+		{"example.com.", "example"},
+		{"www.example.com", "example"},
+		{"a.b.example.com", "example"},
+		{"blog.example.com", "blog"},
+		{"posts.blog.example.com", "blog"},
+		{"myexample.com", "fallback"},
+		{"example.com.evil.net", "fallback"},
+		{"example.org", "fallback"},
+		{"news.co.uk", "co.uk"},
+		{"", "fallback"},
+	}
+	for _, tt := range tests {
+		if got := reg.For(tt.host).Name(); got != tt.want {
+			t.Errorf("For(%q) = %s, want %s", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryExtractFallsBack(t *testing.T) {
+	reg := NewRegistry(namedExtractor{name: "fallback"})
+	reg.Register("example.com", namedExtractor{name: "rule:example.com", err: ErrNoMatch})
+	reg.Register("example.org", namedExtractor{name: "rule:example.org"})
+
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/a", "fallback"},
+		{"https://example.org/a", "rule:example.org"},
+		{"https://example.net/a", "fallback"},
+	}
+	for _, tt := range tests {
+		pageURL, _ := url.Parse(tt.url)
+		article, err := reg.Extract(nil, pageURL)
+		if err != nil {
+			t.Fatalf("Extract(%s): %v", tt.url, err)
+		}
+		if article.Extractor != tt.want || article.Title != tt.want {
+			t.Errorf("Extract(%s): extractor %q, title %q, want %q", tt.url, article.Extractor, article.Title, tt.want)
+		}
+	}
+
+	// A failing fallback is reported
+	failing := NewRegistry(namedExtractor{name: "fallback", err: errors.New("no article")})
+	failing.Register("example.com", namedExtractor{name: "rule", err: ErrNoMatch})
+	pageURL, _ := url.Parse("https://example.com/a")
+	if _, err := failing.Extract(nil, pageURL); err == nil {
+		t.Error("Extract succeeded with every extractor failing")
+	}
+}
+
+func TestSiteRuleFallsBackToReadability(t *testing.T) {
+	rule, err := ParseSiteRule("rule:example.com", strings.NewReader("body: div.gone\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry(Readability{})
+	reg.Register("example.com", rule)
+
+	pageURL, _ := url.Parse("https://example.com/news/1")
+	if _, err := rule.Extract([]byte(testPage), pageURL); !errors.Is(err, ErrNoMatch) {
+		t.Fatalf("rule.Extract: err = %v, want ErrNoMatch", err)
+	}
+	article, err := reg.Extract([]byte(testPage), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Extractor != "readability" {
+		t.Errorf("Extractor = %q, want readability", article.Extractor)
+	}
+	if !strings.Contains(article.TextContent, "The article text.") {
+		t.Errorf("TextContent = %q", article.TextContent)
+	}
+}
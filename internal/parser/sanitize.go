@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// unsafeElements are removed from article content with everything inside
+// them: they run script, embed other documents or only make sense on the
+// original page
+var unsafeElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Link: true, atom.Meta: true, atom.Base: true,
+	atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true,
+	atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+}
+
+// urlAttrs hold a single URL, which must be http or https
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "poster": true, "cite": true, "background": true,
+	"longdesc": true, "action": true, "formaction": true,
+}
+
+// Sanitize makes stored article HTML safe to show on our origin. Elements
+// that run script or embed documents are removed, forms are unwrapped, and
+// event handler attributes and links or sources that aren't http or https
+// are dropped. Relative URLs are resolved against base, or kept as they are
+// if base is nil.
+func Sanitize(fragment string, base *url.URL) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	return renderSanitized(body, base)
+}
+
+// renderSanitized sanitizes the children of a container node and renders
+// what is left of them
+func renderSanitized(container *html.Node, base *url.URL) (string, error) {
+	sanitizeChildren(container, base)
+
+	var buf bytes.Buffer
+	for c := container.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// sanitizeChildren cleans the children of n as Sanitize describes
+func sanitizeChildren(n *html.Node, base *url.URL) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.CommentNode, html.DoctypeNode:
+			n.RemoveChild(c)
+		case html.ElementNode:
+			// SVG and MathML can script and animate their own attributes
+			if unsafeElements[c.DataAtom] || c.Namespace != "" {
+				n.RemoveChild(c)
+				break
+			}
+			sanitizeAttrs(c, base)
+			sanitizeChildren(c, base)
+
+			// Keep a form's contents, which some sites wrap whole pages in
+			if c.DataAtom == atom.Form {
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = gcNext
+				}
+				n.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+func sanitizeAttrs(n *html.Node, base *url.URL) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		switch {
+		case a.Namespace != "", strings.HasPrefix(key, "on"), key == "srcdoc":
+			continue
+		case urlAttrs[key]:
+			val, ok := safeURL(a.Val, base)
+			if !ok {
+				continue
+			}
+			a.Val = val
+		case key == "srcset":
+			val, ok := safeSrcset(a.Val, base)
+			if !ok {
+				continue
+			}
+			a.Val = val
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+}
+
+// safeURL resolves a URL against base and reports whether it is http or
+// https. Relative URLs are safe as they are when there is no base; empty
+// ones never are.
+func safeURL(raw string, base *url.URL) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	case "":
+		return u.String(), base == nil
+	}
+	return "", false
+}
+
+// safeSrcset applies safeURL to each candidate of a srcset, keeping its
+// width or density descriptor. A srcset with any unsafe candidate is
+// dropped.
+func safeSrcset(srcset string, base *url.URL) (string, bool) {
+	var candidates []string
+	for _, c := range strings.Split(srcset, ",") {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		u, ok := safeURL(fields[0], base)
+		if !ok {
+			return "", false
+		}
+		candidates = append(candidates, strings.Join(append([]string{u}, fields[1:]...), " "))
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return strings.Join(candidates, ", "), true
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+
+	tests := []struct {
+		name string
+		in   string
+		base *url.URL
+		want string
+	}{
+		{"plain", `<p>Hello <b>world</b></p>`, base, `<p>Hello <b>world</b></p>`},
+		{"script", `<p>a</p><script>alert(1)</script>`, base, `<p>a</p>`},
+		{"event handlers", `<img src="/a.png" onerror="alert(1)" ONLOAD="x">`, base, `<img src="https://example.com/a.png"/>`},
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, base, `<a>x</a>`},
+		{"javascript href with spaces", `<a href="  JavaScript:alert(1)">x</a>`, nil, `<a>x</a>`},
+		{"javascript href with tab", "<a href=\"java\tscript:alert(1)\">x</a>", nil, `<a>x</a>`},
+		{"data src", `<img src="data:image/svg+xml,<svg onload=alert(1)>">`, base, `<img/>`},
+		{"relative href", `<a href="../b?x=1#c">x</a>`, base, `<a href="https://example.com/b?x=1#c">x</a>`},
+		{"relative without base", `<img src="/api/assets/abc">`, nil, `<img src="/api/assets/abc"/>`},
+		{"fragment", `<a href="#notes">x</a>`, base, `<a href="https://example.com/posts/1#notes">x</a>`},
+		{"iframe", `<p>a</p><iframe src="https://evil.example/"></iframe>`, base, `<p>a</p>`},
+		{"object and embed", `<object data="x.swf"><embed src="x.swf"></object>b`, base, `b`},
+		{"form is unwrapped", `<form action="javascript:x"><p>kept</p><input value="x"><button>go</button></form>`, base, `<p>kept</p>`},
+		{"svg", `<p>a</p><svg><a href="javascript:alert(1)"><text>x</text></a><animate attributeName="href" to="javascript:alert(1)"/></svg>`, base, `<p>a</p>`},
+		{"srcdoc", `<div srcdoc="&lt;script&gt;">x</div>`, base, `<div>x</div>`},
+		{"srcset", `<img srcset="a.png 1x, /b.png 2x">`, base, `<img srcset="https://example.com/posts/a.png 1x, https://example.com/b.png 2x"/>`},
+		{"unsafe srcset", `<img srcset="a.png 1x, javascript:alert(1) 2x">`, base, `<img/>`},
+		{"comment", `<p>a<!-- <script> --></p>`, base, `<p>a</p>`},
+		{"meta and style", `<meta http-equiv="refresh" content="0;url=javascript:x"><style>p{}</style><p>a</p>`, base, `<p>a</p>`},
+		{"style attribute kept", `<p style="color: red" class="x">a</p>`, base, `<p style="color: red" class="x">a</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sanitize(tt.in, tt.base)
+			if err != nil {
+				t.Fatalf("Sanitize: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Sanitize(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiteRuleSanitizes(t *testing.T) {
+	rule, err := ParseSiteRule("example.com", strings.NewReader("title: article h1\nbody: article"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, _ := url.Parse("https://example.com/post")
+	page := `<html><body><article onclick="steal()"><h1>Heading</h1><p>Text</p><a href="javascript:x">l</a>` +
+		`<iframe src="https://evil.example/"></iframe></article></body></html>`
+
+	article, err := rule.Extract([]byte(page), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unwanted := range []string{"onclick", "javascript:", "iframe"} {
+		if strings.Contains(article.Content, unwanted) {
+			t.Errorf("content contains %q: %s", unwanted, article.Content)
+		}
+	}
+	if !strings.Contains(article.Content, "<p>Text</p>") {
+		t.Errorf("content lost the text: %s", article.Content)
+	}
+	if article.Title != "Heading" {
+		t.Errorf("title = %q, want the heading inside the body", article.Title)
+	}
+}
+
+func TestReadabilitySanitizes(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/post")
+	para := strings.Repeat("This is a long enough paragraph of article text to be kept by readability. ", 10)
+	page := `<html><head><title>T</title><meta property="og:image" content="javascript:alert(1)"></head><body><article>` +
+		`<p onmouseover="steal()">` + para + `</p><p>` + para + `<a href="javascript:alert(1)">link</a></p>` +
+		`<p><img src="data:text/html,x" onerror="steal()"></p></article></body></html>`
+
+	article, err := Readability{}.Extract([]byte(page), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unwanted := range []string{"onmouseover", "onerror", "javascript:", "data:"} {
+		if strings.Contains(article.Content, unwanted) {
+			t.Errorf("content contains %q: %s", unwanted, article.Content)
+		}
+	}
+	if article.ImageURL != "" {
+		t.Errorf("ImageURL = %q, want it dropped", article.ImageURL)
+	}
+}
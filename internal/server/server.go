@@ -2,32 +2,81 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"time"
 
+	"pocket-clone/internal/auth"
 	"pocket-clone/internal/handlers"
+	"pocket-clone/internal/ingest"
 	"pocket-clone/internal/storage"
 )
 
 type Server struct {
 	httpServer *http.Server
 	db         *storage.SQLiteDB
+	queue      *ingest.Queue
+	// ctx is the parent of every request's context. Shutdown cancels it to
+	// stop the fetches and queries of requests in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func New(db *storage.SQLiteDB, port string) *Server {
-	s := &Server{db: db}
+// publicRoutes can be called without credentials. CreateUser only allows
+// anonymous callers to create the first account.
+//
+// Assets are public so that <img> tags work in every client: browsers don't
+// send Bearer tokens with image requests, so the Android app and the
+// extension couldn't show archived images otherwise. Their URLs are SHA-256
+// hashes of images fetched from public pages, so an asset can only be
+// requested by someone who already has the image or an article that shows
+// it.
+var publicRoutes = []string{
+	"POST /api/users",
+	"GET /api/assets/",
+	"HEAD /api/assets/",
+}
+
+// New creates a server that fetches saved articles with queue. The server
+// starts and stops the queue along with itself.
+func New(db *storage.SQLiteDB, queue *ingest.Queue, port string) *Server {
+	s := &Server{db: db, queue: queue}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	mux := http.NewServeMux()
-	h := handlers.New(db)
+	h := handlers.New(db, s.queue)
 
 	// API routes
+	mux.HandleFunc("POST /api/users", h.CreateUser)
+	mux.HandleFunc("GET /api/me", h.GetCurrentUser)
+	mux.HandleFunc("POST /api/tokens", h.CreateToken)
+	mux.HandleFunc("GET /api/tokens", h.ListTokens)
+	mux.HandleFunc("DELETE /api/tokens/{id}", h.DeleteToken)
 	mux.HandleFunc("POST /api/articles", h.CreateArticle)
 	mux.HandleFunc("GET /api/articles", h.ListArticles)
+	mux.HandleFunc("POST /api/articles/refresh", h.RefreshArticles)
 	mux.HandleFunc("GET /api/articles/{id}", h.GetArticle)
 	mux.HandleFunc("PATCH /api/articles/{id}", h.UpdateArticle)
 	mux.HandleFunc("DELETE /api/articles/{id}", h.DeleteArticle)
+	mux.HandleFunc("PATCH /api/articles/{id}/progress", h.UpdateProgress)
+	mux.HandleFunc("POST /api/articles/{id}/refresh", h.RefreshArticle)
+	mux.HandleFunc("GET /api/articles/{id}/revisions", h.ListRevisions)
+	mux.HandleFunc("GET /api/articles/{id}/revisions/{rev}/diff", h.RevisionDiff)
+	mux.HandleFunc("POST /api/articles/{id}/highlights", h.CreateHighlight)
+	mux.HandleFunc("GET /api/articles/{id}/highlights", h.ListHighlights)
+	mux.HandleFunc("PATCH /api/articles/{id}/highlights/{highlight}", h.UpdateHighlight)
+	mux.HandleFunc("DELETE /api/articles/{id}/highlights/{highlight}", h.DeleteHighlight)
+	mux.HandleFunc("GET /api/highlights", h.ListAllHighlights)
+	mux.HandleFunc("GET /api/articles/{id}/epub", h.ArticleEPUB)
+	mux.HandleFunc("GET /api/articles/{id}/snapshot", h.GetSnapshot)
+	mux.HandleFunc("GET /api/articles/{id}/original", h.GetOriginal)
+	mux.HandleFunc("GET /api/articles/{id}/similar", h.SimilarArticles)
 	mux.HandleFunc("GET /api/search", h.Search)
+	mux.HandleFunc("POST /api/import", h.Import)
+	mux.HandleFunc("GET /api/export", h.Export)
+	mux.HandleFunc("GET /api/assets/{hash}", h.GetAsset)
 	mux.HandleFunc("GET /api/tags", h.ListTags)
+	mux.HandleFunc("GET /api/tags/{tag}/epub", h.TagEPUB)
 	mux.HandleFunc("POST /api/articles/{id}/tags", h.AddTag)
 	mux.HandleFunc("DELETE /api/articles/{id}/tags/{tag}", h.RemoveTag)
 
@@ -36,30 +85,44 @@ func New(db *storage.SQLiteDB, port string) *Server {
 
 	s.httpServer = &http.Server{
 		Addr:         ":" + port,
-		Handler:      corsMiddleware(mux),
+		Handler:      corsMiddleware(auth.Middleware(db, publicRoutes, mux)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
 	}
 
 	return s
 }
 
 func (s *Server) Start() error {
+	s.queue.Start()
+	if err := s.queue.EnqueuePending(s.ctx); err != nil {
+		return err
+	}
 	return s.httpServer.ListenAndServe()
 }
 
+// Shutdown stops accepting requests and cancels the work in flight: the
+// fetches and queries of open requests, and the articles the ingest workers
+// are fetching, which stay pending for the next start. It returns once
+// they have all stopped.
 func (s *Server) Shutdown() error {
+	s.cancel()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	s.queue.Stop()
+	return err
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
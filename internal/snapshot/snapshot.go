@@ -0,0 +1,423 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"pocket-clone/internal/fetch"
+)
+
+const (
+	// maxResourceSize caps each inlined stylesheet, image or font
+	maxResourceSize = 5 << 20
+
+	// maxTotalSize caps the inlined resources of one page. Resources past
+	// the limit keep their remote URL.
+	maxTotalSize = 30 << 20
+
+	// maxImportDepth stops runaway chains of CSS @import
+	maxImportDepth = 3
+)
+
+// fetcher downloads stylesheets, images and fonts
+var fetcher = fetch.New(maxResourceSize)
+
+var (
+	cssURL    = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)\s]*))\s*\)`)
+	cssImport = regexp.MustCompile(`@import\s+(?:url\(\s*)?(?:"([^"]*)"|'([^']*)'|([^\s;)]+))\s*\)?([^;]*);`)
+)
+
+// SingleFile turns a fetched page, converted to UTF-8, into a self-contained
+// UTF-8 HTML document: stylesheets, images and fonts are inlined as data
+// URIs, and scripts, frames and event handlers are removed. Resources that
+// can't be fetched keep their absolute URL. It gives up when ctx is done.
+func SingleFile(ctx context.Context, page []byte, pageURL *url.URL) ([]byte, error) {
+	doc, err := html.ParseWithOptions(bytes.NewReader(page), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{ctx: ctx, base: pageURL, inlined: map[string]string{}}
+	if href := findBase(doc); href != "" {
+		if u, err := pageURL.Parse(href); err == nil {
+			b.base = u
+		}
+	}
+	b.walk(doc)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	insertBase(doc, b.base.String())
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WithBase adds a <base> element to a page so that its relative links and
+// resources resolve against the original site. The page is otherwise left
+// byte for byte as it was.
+func WithBase(page []byte, base string) []byte {
+	tag := `<base href="` + html.EscapeString(base) + `">`
+
+	var out bytes.Buffer
+	out.Grow(len(page) + len(tag))
+	inserted := false
+
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+
+		if !inserted && (tt == html.StartTagToken || tt == html.SelfClosingTagToken) {
+			name, _ := z.TagName()
+			switch string(name) {
+			case "html":
+			case "head":
+				out.Write(raw)
+				out.WriteString(tag)
+				inserted = true
+				continue
+			default:
+				// No <head> tag; the element lands in the implied head
+				out.WriteString(tag)
+				inserted = true
+			}
+		}
+		out.Write(raw)
+	}
+
+	if !inserted {
+		out.WriteString(tag)
+	}
+	return out.Bytes()
+}
+
+type builder struct {
+	ctx     context.Context
+	base    *url.URL
+	inlined map[string]string
+	total   int
+}
+
+func (b *builder) walk(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		if c.Type == html.ElementNode {
+			switch c.DataAtom {
+			case atom.Script, atom.Iframe, atom.Frame, atom.Frameset, atom.Object, atom.Embed, atom.Base:
+				n.RemoveChild(c)
+			case atom.Noscript:
+				// Scripts won't run in the snapshot, so show the fallback
+				b.walk(c)
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = gcNext
+				}
+				n.RemoveChild(c)
+			case atom.Link:
+				b.link(n, c)
+			case atom.Meta:
+				// Refreshes would navigate away and a page's own CSP could
+				// block the inlined resources. The page's charset no longer
+				// applies.
+				switch strings.ToLower(attr(c, "http-equiv")) {
+				case "refresh", "content-security-policy", "content-type":
+					n.RemoveChild(c)
+				default:
+					if attr(c, "charset") != "" {
+						setAttr(c, "charset", "utf-8")
+					}
+				}
+			case atom.Source:
+				// Drop responsive alternatives so <picture> falls back to
+				// the inlined <img>
+				if n.DataAtom == atom.Picture {
+					n.RemoveChild(c)
+				} else {
+					b.attrs(c)
+				}
+			case atom.Style:
+				if t := c.FirstChild; t != nil && t.Type == html.TextNode {
+					t.Data = b.css(t.Data, b.base, 0)
+				}
+			default:
+				b.attrs(c)
+				b.walk(c)
+			}
+		}
+
+		c = next
+	}
+}
+
+// link inlines stylesheets and icons and drops resource hints
+func (b *builder) link(parent, n *html.Node) {
+	rels := strings.Fields(strings.ToLower(attr(n, "rel")))
+	href := attr(n, "href")
+
+	for _, rel := range rels {
+		switch rel {
+		case "stylesheet":
+			if hasRel(rels, "alternate") {
+				parent.RemoveChild(n)
+				return
+			}
+			u, err := b.base.Parse(strings.TrimSpace(href))
+			if err != nil {
+				parent.RemoveChild(n)
+				return
+			}
+			data, _, err := b.fetch(u.String())
+			if err != nil {
+				log.Printf("snapshot: %s: %v", u, err)
+				setAttr(n, "href", u.String())
+				return
+			}
+
+			style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+			if media := attr(n, "media"); media != "" {
+				style.Attr = []html.Attribute{{Key: "media", Val: media}}
+			}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: b.css(string(data), u, 0)})
+			parent.InsertBefore(style, n)
+			parent.RemoveChild(n)
+			return
+		case "icon", "apple-touch-icon":
+			if uri := b.inline(href, b.base); uri != "" {
+				setAttr(n, "href", uri)
+			}
+			return
+		case "preload", "prefetch", "modulepreload", "preconnect", "dns-prefetch", "manifest":
+			parent.RemoveChild(n)
+			return
+		}
+	}
+}
+
+// attrs strips event handlers and javascript: URLs and inlines the images
+// an element refers to
+func (b *builder) attrs(n *html.Node) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") {
+			continue
+		}
+		if (key == "href" || key == "src" || key == "action" || key == "formaction") &&
+			strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+			continue
+		}
+		if key == "style" {
+			a.Val = b.css(a.Val, b.base, maxImportDepth)
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+
+	switch n.DataAtom {
+	case atom.Img:
+		if uri := b.inline(attr(n, "src"), b.base); uri != "" {
+			setAttr(n, "src", uri)
+			removeAttrs(n, "srcset", "sizes")
+		}
+	case atom.Video:
+		if uri := b.inline(attr(n, "poster"), b.base); uri != "" {
+			setAttr(n, "poster", uri)
+		}
+	case atom.Input:
+		if strings.EqualFold(attr(n, "type"), "image") {
+			if uri := b.inline(attr(n, "src"), b.base); uri != "" {
+				setAttr(n, "src", uri)
+			}
+		}
+	}
+}
+
+// css inlines the imports and url() references of a stylesheet. base is the
+// stylesheet's own URL, which relative references resolve against.
+func (b *builder) css(text string, base *url.URL, depth int) string {
+	if depth < maxImportDepth {
+		text = cssImport.ReplaceAllStringFunc(text, func(m string) string {
+			sub := cssImport.FindStringSubmatch(m)
+			ref := firstNonEmpty(sub[1], sub[2], sub[3])
+			u, err := base.Parse(strings.TrimSpace(ref))
+			if err != nil {
+				return ""
+			}
+			data, _, err := b.fetch(u.String())
+			if err != nil {
+				log.Printf("snapshot: %s: %v", u, err)
+				return fmt.Sprintf("@import url(%q)%s;", u.String(), sub[4])
+			}
+
+			imported := b.css(string(data), u, depth+1)
+			if media := strings.TrimSpace(sub[4]); media != "" {
+				return "@media " + media + " {\n" + imported + "\n}"
+			}
+			return imported
+		})
+	}
+
+	return cssURL.ReplaceAllStringFunc(text, func(m string) string {
+		sub := cssURL.FindStringSubmatch(m)
+		ref := firstNonEmpty(sub[1], sub[2], sub[3])
+		if uri := b.inline(ref, base); uri != "" {
+			return fmt.Sprintf("url(%q)", uri)
+		}
+		if u, err := base.Parse(strings.TrimSpace(ref)); err == nil && !strings.HasPrefix(ref, "#") {
+			return fmt.Sprintf("url(%q)", u.String())
+		}
+		return m
+	})
+}
+
+// inline returns a data URI for the resource at ref, or "" if it can't be
+// fetched
+func (b *builder) inline(ref string, base *url.URL) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "data:") {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	if uri, ok := b.inlined[u.String()]; ok {
+		return uri
+	}
+
+	uri := ""
+	data, mediaType, err := b.fetch(u.String())
+	if err != nil {
+		log.Printf("snapshot: %s: %v", u, err)
+	} else {
+		uri = "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	b.inlined[u.String()] = uri
+	return uri
+}
+
+func (b *builder) fetch(src string) ([]byte, string, error) {
+	if b.total >= maxTotalSize {
+		return nil, "", fmt.Errorf("snapshot larger than %d bytes", maxTotalSize)
+	}
+
+	resp, err := fetcher.Get(b.ctx, src)
+	if err != nil {
+		return nil, "", err
+	}
+	b.total += len(resp.Body)
+	return resp.Body, resp.MediaType, nil
+}
+
+// findBase returns the href of the page's first <base> element
+func findBase(n *html.Node) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Base {
+		if href := attr(n, "href"); href != "" {
+			return href
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href := findBase(c); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+// insertBase makes the page's remaining relative URLs, such as links,
+// resolve against the original site
+func insertBase(doc *html.Node, href string) {
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return
+	}
+	base := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "base",
+		DataAtom: atom.Base,
+		Attr:     []html.Attribute{{Key: "href", Val: href}},
+	}
+	head.InsertBefore(base, head.FirstChild)
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func hasRel(rels []string, rel string) bool {
+	for _, r := range rels {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttrs(n *html.Node, keys ...string) {
+	kept := n.Attr[:0]
+outer:
+	for _, a := range n.Attr {
+		for _, k := range keys {
+			if a.Key == k {
+				continue outer
+			}
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+}
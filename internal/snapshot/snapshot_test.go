@@ -0,0 +1,220 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"pocket-clone/internal/fetch"
+)
+
+// png is the start of a PNG file, enough to be served as an image
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// newSite serves a page's resources, counting the requests for each path
+func newSite(t *testing.T, resources map[string]string) (*httptest.Server, map[string]int) {
+	t.Helper()
+	fetch.AllowPrivate = true
+	t.Cleanup(func() { fetch.AllowPrivate = false })
+
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".png"):
+			w.Header().Set("Content-Type", "image/png")
+		case strings.HasSuffix(r.URL.Path, ".css"):
+			w.Header().Set("Content-Type", "text/css")
+		}
+		body, ok := resources[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func singleFile(t *testing.T, srv *httptest.Server, page string) string {
+	t.Helper()
+	pageURL, _ := url.Parse(srv.URL + "/posts/1")
+	out, err := SingleFile(context.Background(), []byte(page), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSingleFileInlinesResources(t *testing.T) {
+	srv, requests := newSite(t, map[string]string{
+		"/style.css":        `@import "print.css" print; body { background: url(/bg.png) } h1 { background: url('../posts/img.png') }`,
+		"/print.css":        `p { color: black }`,
+		"/posts/img.png":    string(png),
+		"/bg.png":           string(png),
+		"/posts/hero.png":   string(png),
+		"/posts/inline.png": string(png),
+	})
+
+	out := singleFile(t, srv, `<!DOCTYPE html><html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate stylesheet" href="/alt.css">
+<link rel="preload" href="/font.woff2">
+<style>.x { background: url("inline.png") }</style>
+</head><body>
+<h1>Title</h1>
+<img src="hero.png" srcset="hero-2x.png 2x" sizes="100vw">
+<img src="img.png">
+<div style="background-image: url(inline.png)">x</div>
+</body></html>`)
+
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	for _, want := range []string{
+		`<img src="` + dataURI + `"/>`,
+		`background: url("` + dataURI + `")`,
+		`p { color: black }`,
+		`@media print {`,
+		`<base href="` + srv.URL + `/posts/1"/>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"style.css", "alt.css", "font.woff2", "srcset", "sizes", "hero.png", "inline.png", "/bg.png"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output still refers to %s:\n%s", unwanted, out)
+		}
+	}
+
+	// A resource used more than once is fetched once
+	if n := requests["/posts/inline.png"]; n != 1 {
+		t.Errorf("inline.png fetched %d times, want 1", n)
+	}
+	for _, path := range []string{"/alt.css", "/font.woff2"} {
+		if requests[path] != 0 {
+			t.Errorf("%s was fetched", path)
+		}
+	}
+}
+
+func TestSingleFileStripsScripts(t *testing.T) {
+	srv, _ := newSite(t, nil)
+
+	out := singleFile(t, srv, `<html><head>
+<meta http-equiv="refresh" content="0;url=https://evil.example/">
+<meta http-equiv="Content-Security-Policy" content="img-src 'none'">
+<meta charset="iso-8859-1">
+<script src="/app.js"></script>
+<script>document.write("injected")</script>
+</head><body onload="start()">
+<p onclick="track()">Text</p>
+<a href="javascript:alert(1)">link</a>
+<a href="/next">next</a>
+<form action="javascript:steal()"><button formaction="javascript:x()">go</button></form>
+<iframe src="https://ads.example/"></iframe>
+<object data="x.swf"></object><embed src="x.swf">
+<noscript><p>Enable JavaScript</p></noscript>
+</body></html>`)
+
+	for _, unwanted := range []string{"<script", "app.js", "injected", "onload", "onclick", "javascript:", "<iframe", "<object", "<embed", "<noscript", "refresh", "Content-Security-Policy", "iso-8859-1"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output contains %s:\n%s", unwanted, out)
+		}
+	}
+	for _, want := range []string{"<p>Text</p>", `<a href="/next">next</a>`, "<p>Enable JavaScript</p>", `<meta charset="utf-8"/>`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSingleFileKeepsMissingResources(t *testing.T) {
+	srv, _ := newSite(t, nil)
+
+	out := singleFile(t, srv, `<html><head><link rel="stylesheet" href="missing.css"></head>
+<body><img src="missing.png"></body></html>`)
+
+	for _, want := range []string{
+		`<link rel="stylesheet" href="` + srv.URL + `/posts/missing.css"/>`,
+		`<img src="missing.png"/>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSingleFileSizeLimits(t *testing.T) {
+	srv, requests := newSite(t, map[string]string{
+		"/huge.png":  string(png) + strings.Repeat("\x00", maxResourceSize),
+		"/small.png": string(png),
+	})
+
+	// A resource over the per-resource limit keeps its URL
+	out := singleFile(t, srv, `<img src="/huge.png"><img src="/small.png">`)
+	if !strings.Contains(out, `<img src="/huge.png"/>`) {
+		t.Errorf("oversized image was inlined")
+	}
+	if !strings.Contains(out, "data:image/png;base64,") {
+		t.Errorf("small image wasn't inlined")
+	}
+
+	// Once the page's total is reached nothing more is fetched
+	base, _ := url.Parse(srv.URL)
+	b := &builder{ctx: context.Background(), base: base, inlined: map[string]string{}}
+	if uri := b.inline("/small.png", base); uri == "" {
+		t.Fatal("image under the limit wasn't inlined")
+	}
+	if b.total != len(png) {
+		t.Errorf("total = %d, want %d", b.total, len(png))
+	}
+	requests["/small.png"] = 0
+	b.total = maxTotalSize
+	b.inlined = map[string]string{}
+	if uri := b.inline("/small.png", base); uri != "" {
+		t.Error("image was inlined past the page's total limit")
+	}
+	if requests["/small.png"] != 0 {
+		t.Error("image was fetched past the page's total limit")
+	}
+}
+
+func TestSingleFileCancelled(t *testing.T) {
+	srv, _ := newSite(t, map[string]string{"/a.png": string(png)})
+	pageURL, _ := url.Parse(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := SingleFile(ctx, []byte(`<img src="/a.png">`), pageURL); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestWithBase(t *testing.T) {
+	const tag = `<base href="https://example.com/a?x=1&amp;y=2">`
+	tests := []struct {
+		name, page, want string
+	}{
+		{"head", `<html><head><title>T</title></head><body>x</body></html>`,
+			`<html><head>` + tag + `<title>T</title></head><body>x</body></html>`},
+		{"head with attributes", `<!DOCTYPE html><html lang="en"><head data-x="1"><meta charset="utf-8">`,
+			`<!DOCTYPE html><html lang="en"><head data-x="1">` + tag + `<meta charset="utf-8">`},
+		{"no head", `<html><title>T</title>`, `<html>` + tag + `<title>T</title>`},
+		{"fragment", `<p>Hi <b>there</b></p>`, tag + `<p>Hi <b>there</b></p>`},
+		{"text only", `just text`, `just text` + tag},
+		{"empty", ``, tag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(WithBase([]byte(tt.page), "https://example.com/a?x=1&y=2"))
+			if got != tt.want {
+				t.Errorf("WithBase(%q)\n got %q\nwant %q", tt.page, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Asset is a stored copy of an image referenced by an article
+type Asset struct {
+	Hash      string
+	MediaType string
+	Data      []byte
+}
+
+// SaveAsset stores an asset and links it to an article. Content that is
+// already stored is shared rather than duplicated.
+func (s *SQLiteDB) SaveAsset(ctx context.Context, articleID int64, asset *Asset, originalURL string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO assets (hash, media_type, size, data) VALUES (?, ?, ?, ?)
+	`, asset.Hash, asset.MediaType, len(asset.Data), asset.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO article_assets (article_id, hash, original_url) VALUES (?, ?, ?)
+	`, articleID, asset.Hash, originalURL)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAsset returns a stored asset by content hash
+func (s *SQLiteDB) GetAsset(ctx context.Context, hash string) (*Asset, error) {
+	asset := &Asset{Hash: hash}
+	err := s.db.QueryRowContext(ctx, "SELECT media_type, data FROM assets WHERE hash = ?", hash).Scan(&asset.MediaType, &asset.Data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// pruneAssets unlinks the assets an article's content and lead image no
+// longer refer to. The article_assets_ad trigger deletes assets that are
+// left without links.
+func pruneAssets(ctx context.Context, tx *sql.Tx, articleID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM article_assets
+		WHERE article_id = ? AND NOT EXISTS (
+			SELECT 1 FROM articles a
+			WHERE a.id = article_assets.article_id
+				AND (instr(COALESCE(a.content, ''), article_assets.hash) > 0
+					OR instr(COALESCE(a.image_url, ''), article_assets.hash) > 0)
+		)
+	`, articleID)
+	return err
+}
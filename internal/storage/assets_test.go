@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func testAsset(b byte) *Asset {
+	return &Asset{Hash: strings.Repeat(string("0123456789abcdef"[b%16]), 64), MediaType: "image/png", Data: []byte{b}}
+}
+
+func assetExists(t *testing.T, db *SQLiteDB, hash string) bool {
+	t.Helper()
+	var n int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM assets WHERE hash = ?", hash).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestRefreshArticlePrunesAssets(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a"})
+	other := newTestArticle(t, db, user, &Article{URL: "https://example.com/b"})
+
+	kept, dropped, shared, lead := testAsset(1), testAsset(2), testAsset(3), testAsset(4)
+	for _, a := range []*Asset{kept, dropped, shared, lead} {
+		if err := db.SaveAsset(ctx, id, a, "https://example.com/img"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveAsset(ctx, other, shared, "https://example.com/img"); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := &Article{
+		Title:       "A",
+		Content:     `<img src="/api/assets/` + kept.Hash + `">`,
+		TextContent: "a",
+		ImageURL:    "/api/assets/" + lead.Hash,
+	}
+	if changed, err := db.RefreshArticle(ctx, id, parsed); err != nil || !changed {
+		t.Fatalf("RefreshArticle = %v, %v", changed, err)
+	}
+
+	tests := []struct {
+		name  string
+		asset *Asset
+		want  bool
+	}{
+		{"in content", kept, true},
+		{"lead image", lead, true},
+		{"no longer shown", dropped, false},
+		{"shown by another article", shared, true},
+	}
+	for _, tt := range tests {
+		if got := assetExists(t, db, tt.asset.Hash); got != tt.want {
+			t.Errorf("%s: asset exists = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := db.GetAsset(ctx, shared.Hash); err != nil {
+		t.Errorf("shared asset: %v", err)
+	}
+
+	// Deleting the other article removes the last link to the shared asset
+	if err := db.DeleteArticle(ctx, user, other); err != nil {
+		t.Fatal(err)
+	}
+	if assetExists(t, db, shared.Hash) {
+		t.Error("asset without links is kept")
+	}
+}
+
+func TestUpdateArticlePrunesAssets(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	kept, dropped := testAsset(1), testAsset(2)
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a",
+		Content: `<img src="/api/assets/` + kept.Hash + `"><img src="/api/assets/` + dropped.Hash + `">`})
+	for _, a := range []*Asset{kept, dropped} {
+		if err := db.SaveAsset(ctx, id, a, "https://example.com/img"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Changing only the title leaves the images alone
+	title := "Edited"
+	if err := db.UpdateArticle(ctx, user, id, ArticleUpdate{Title: &title}); err != nil {
+		t.Fatal(err)
+	}
+	if !assetExists(t, db, dropped.Hash) {
+		t.Error("image dropped by a title edit")
+	}
+
+	content := `<p>Shorter</p><img src="/api/assets/` + kept.Hash + `">`
+	text := "Shorter"
+	if err := db.UpdateArticle(ctx, user, id, ArticleUpdate{Content: &content, TextContent: &text}); err != nil {
+		t.Fatal(err)
+	}
+	if !assetExists(t, db, kept.Hash) {
+		t.Error("image the edited content shows was dropped")
+	}
+	if assetExists(t, db, dropped.Hash) {
+		t.Error("image the edit removed is kept")
+	}
+}
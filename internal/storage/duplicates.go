@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"pocket-clone/internal/canonical"
+)
+
+// minDuplicateWords is how long a text must be for articles to be taken as
+// duplicates because their text is the same. Shorter texts, such as
+// paywall notices, are shared by unrelated pages.
+const minDuplicateWords = 50
+
+// contentHash returns the SHA-256 of a text with case and whitespace
+// normalized, or nil for no text
+func contentHash(text string) interface{} {
+	if text == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(text), " "))))
+	return hex.EncodeToString(sum[:])
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// FindArticleByURL returns the user's article saved from the URL or from
+// another address of the same page, as told by canonical.Key or by the page's
+// canonical URL. It returns ErrNotFound if there is none.
+func (s *SQLiteDB) FindArticleByURL(ctx context.Context, userID int64, rawURL string) (*Article, error) {
+	key := canonical.Key(rawURL)
+	if key == "" {
+		return nil, ErrNotFound
+	}
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM articles
+		WHERE user_id = ? AND (url_key = ? OR canonical_key = ?)
+		ORDER BY id
+		LIMIT 1
+	`, userID, key, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetArticle(ctx, userID, id)
+}
+
+// MergeDuplicate checks whether a newly fetched article is a page its user
+// already has, by the canonical URL the page gives or by the same text. If
+// so it merges the new article into the existing one and returns the
+// existing article's ID; otherwise it returns 0. The existing article gains
+// the new one's tags, and its read state, archived flag and favorite if
+// they are further along, as when an import restores them. The new
+// article's ID resolves to the existing one through MergedInto.
+func (s *SQLiteDB) MergeDuplicate(ctx context.Context, id int64, parsed *Article) (int64, error) {
+	key := canonical.Key(parsed.CanonicalURL)
+	var hash interface{}
+	if countWords(parsed.TextContent) >= minDuplicateWords {
+		hash = contentHash(parsed.TextContent)
+	}
+	if key == "" && hash == nil {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var existing int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT other.id
+		FROM articles a
+		JOIN articles other ON other.user_id = a.user_id AND other.id != a.id
+		WHERE a.id = ? AND (
+			(? != '' AND (other.url_key = ? OR other.canonical_key = ?))
+			OR (other.content_hash = ? AND other.word_count >= ?)
+		)
+		ORDER BY other.id
+		LIMIT 1
+	`, id, key, key, key, hash, minDuplicateWords).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE articles AS e SET
+			archived = MAX(e.archived, d.archived),
+			favorite = MAX(e.favorite, d.favorite),
+			favorited_at = CASE WHEN e.favorite THEN e.favorited_at ELSE d.favorited_at END,
+			read_state = CASE WHEN `+readRank("d")+` > `+readRank("e")+` THEN d.read_state ELSE e.read_state END,
+			read_at = CASE WHEN `+readRank("d")+` > `+readRank("e")+` THEN d.read_at ELSE e.read_at END
+		FROM articles AS d
+		WHERE e.id = ? AND d.id = ?
+	`, existing, id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO article_tags (article_id, tag_id)
+		SELECT ?, tag_id FROM article_tags WHERE article_id = ?
+	`, existing, id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Articles merged into this one earlier follow it
+	if _, err := tx.ExecContext(ctx, "UPDATE merged_articles SET article_id = ? WHERE article_id = ?", existing, id); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO merged_articles (id, user_id, article_id)
+		SELECT id, user_id, ? FROM articles WHERE id = ?
+	`, existing, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM articles WHERE id = ?", id); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return existing, nil
+}
+
+// readRank orders the read states of the articles table aliased as table
+// from unread to read
+func readRank(table string) string {
+	return "CASE " + table + ".read_state WHEN '" + ReadStateRead + "' THEN 2 WHEN '" + ReadStateInProgress + "' THEN 1 ELSE 0 END"
+}
+
+// MergedInto returns the ID of the article that the user's article id was
+// merged into as a duplicate, or ErrNotFound if it wasn't
+func (s *SQLiteDB) MergedInto(ctx context.Context, userID, id int64) (int64, error) {
+	var existing int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT article_id FROM merged_articles WHERE id = ? AND user_id = ?
+	`, id, userID).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return existing, nil
+}
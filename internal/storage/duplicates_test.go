@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMergeDuplicate(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	other := newTestUser(t, db, "bob")
+
+	existing, _, err := db.ImportArticle(ctx, user, &Article{URL: "https://example.com/a", Tags: []string{"go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dup, _, err := db.ImportArticle(ctx, user, &Article{
+		URL:      "https://mirror.example.org/a",
+		ReadAt:   &readAt,
+		Archived: true,
+		Tags:     []string{"go", "news"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite := true
+	if err := db.UpdateArticle(ctx, user, dup, ArticleUpdate{Favorite: &favorite}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.MergeDuplicate(ctx, dup, &Article{CanonicalURL: "https://example.com/a"})
+	if err != nil || got != existing {
+		t.Fatalf("MergeDuplicate = %d, %v, want %d", got, err, existing)
+	}
+
+	a, err := db.GetArticle(ctx, user, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ReadState != ReadStateRead || a.ReadAt == nil || !a.ReadAt.Equal(readAt) {
+		t.Errorf("read state = %s at %v, want read at %v", a.ReadState, a.ReadAt, readAt)
+	}
+	if !a.Archived {
+		t.Error("archived flag was lost")
+	}
+	if !a.Favorite || a.FavoritedAt == nil {
+		t.Errorf("favorite = %v at %v, want starred", a.Favorite, a.FavoritedAt)
+	}
+	if fmt.Sprint(a.Tags) != "[go news]" {
+		t.Errorf("tags = %v, want [go news]", a.Tags)
+	}
+
+	if _, err := db.GetArticle(ctx, user, dup); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetArticle(duplicate): err = %v, want ErrNotFound", err)
+	}
+	if got, err := db.MergedInto(ctx, user, dup); err != nil || got != existing {
+		t.Errorf("MergedInto = %d, %v, want %d", got, err, existing)
+	}
+	if _, err := db.MergedInto(ctx, other, dup); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MergedInto(other user): err = %v, want ErrNotFound", err)
+	}
+	if _, err := db.MergedInto(ctx, user, existing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MergedInto(existing): err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMergeDuplicateKeepsFurtherState(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+
+	readAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	existing, _, err := db.ImportArticle(ctx, user, &Article{URL: "https://example.com/a", ReadAt: &readAt, Archived: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup := newTestArticle(t, db, user, &Article{URL: "https://mirror.example.org/a"})
+
+	if got, err := db.MergeDuplicate(ctx, dup, &Article{CanonicalURL: "https://example.com/a"}); err != nil || got != existing {
+		t.Fatalf("MergeDuplicate = %d, %v, want %d", got, err, existing)
+	}
+	a, err := db.GetArticle(ctx, user, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ReadState != ReadStateRead || !a.Archived {
+		t.Errorf("read state = %s, archived = %v; an unread duplicate changed them", a.ReadState, a.Archived)
+	}
+}
+
+func TestMergeDuplicateFollowsEarlierMerges(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+
+	first := newTestArticle(t, db, user, &Article{URL: "https://example.com/a"})
+	second := newTestArticle(t, db, user, &Article{URL: "https://b.example.org/a"})
+	third := newTestArticle(t, db, user, &Article{URL: "https://c.example.org/a"})
+
+	// The third save is merged into the second, which then turns out to be
+	// the first
+	if got, err := db.MergeDuplicate(ctx, third, &Article{CanonicalURL: "https://b.example.org/a"}); err != nil || got != second {
+		t.Fatalf("MergeDuplicate(third) = %d, %v, want %d", got, err, second)
+	}
+	if got, err := db.MergeDuplicate(ctx, second, &Article{CanonicalURL: "https://example.com/a"}); err != nil || got != first {
+		t.Fatalf("MergeDuplicate(second) = %d, %v, want %d", got, err, first)
+	}
+
+	for _, id := range []int64{second, third} {
+		if got, err := db.MergedInto(ctx, user, id); err != nil || got != first {
+			t.Errorf("MergedInto(%d) = %d, %v, want %d", id, got, err, first)
+		}
+	}
+
+	// Deleting the article drops the redirects to it
+	if err := db.DeleteArticle(ctx, user, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MergedInto(ctx, user, second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MergedInto after delete: err = %v, want ErrNotFound", err)
+	}
+}
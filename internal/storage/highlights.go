@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Highlight is a passage of an article's text marked by the user, with an
+// optional note. The quote, prefix and suffix follow the W3C text quote
+// selector; Start and End are character offsets into the article's
+// TextContent when the passage could be located.
+type Highlight struct {
+	ID        int64     `json:"id"`
+	ArticleID int64     `json:"article_id"`
+	Quote     string    `json:"quote"`
+	Prefix    string    `json:"prefix"`
+	Suffix    string    `json:"suffix"`
+	Start     *int      `json:"start"`
+	End       *int      `json:"end"`
+	Note      string    `json:"note"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Set in the feed of all highlights
+	ArticleTitle string `json:"article_title,omitempty"`
+	ArticleURL   string `json:"article_url,omitempty"`
+}
+
+const highlightColumns = `h.id, h.article_id, h.quote, h.prefix, h.suffix, h.start_offset, h.end_offset, h.note, h.color, h.created_at`
+
+func scanHighlight(row interface{ Scan(...any) error }, extra ...any) (*Highlight, error) {
+	h := &Highlight{}
+	var start, end sql.NullInt64
+	dest := []any{&h.ID, &h.ArticleID, &h.Quote, &h.Prefix, &h.Suffix, &start, &end, &h.Note, &h.Color, &h.CreatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if start.Valid && end.Valid {
+		s, e := int(start.Int64), int(end.Int64)
+		h.Start, h.End = &s, &e
+	}
+	return h, nil
+}
+
+// CreateHighlight adds a highlight to one of a user's articles
+func (s *SQLiteDB) CreateHighlight(ctx context.Context, userID int64, h *Highlight) error {
+	if err := s.checkArticle(ctx, userID, h.ArticleID); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO highlights (article_id, quote, prefix, suffix, start_offset, end_offset, note, color)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, h.ArticleID, h.Quote, h.Prefix, h.Suffix, h.Start, h.End, h.Note, h.Color)
+	if err != nil {
+		return err
+	}
+
+	h.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx, "SELECT created_at FROM highlights WHERE id = ?", h.ID).Scan(&h.CreatedAt)
+}
+
+// ListHighlights returns the highlights of one of a user's articles in the
+// order they appear in the text
+func (s *SQLiteDB) ListHighlights(ctx context.Context, userID, articleID int64) ([]Highlight, error) {
+	if err := s.checkArticle(ctx, userID, articleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+highlightColumns+`
+		FROM highlights h
+		WHERE h.article_id = ?
+		ORDER BY h.start_offset IS NULL, h.start_offset, h.id
+	`, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	highlights := []Highlight{}
+	for rows.Next() {
+		h, err := scanHighlight(rows)
+		if err != nil {
+			return nil, err
+		}
+		highlights = append(highlights, *h)
+	}
+	return highlights, rows.Err()
+}
+
+// GetHighlight returns a highlight on one of a user's articles
+func (s *SQLiteDB) GetHighlight(ctx context.Context, userID, articleID, id int64) (*Highlight, error) {
+	return scanHighlight(s.db.QueryRowContext(ctx, `
+		SELECT `+highlightColumns+`
+		FROM highlights h
+		JOIN articles a ON a.id = h.article_id
+		WHERE h.id = ? AND h.article_id = ? AND a.user_id = ?
+	`, id, articleID, userID))
+}
+
+// UpdateHighlight changes the note and color of a highlight
+func (s *SQLiteDB) UpdateHighlight(ctx context.Context, userID, articleID, id int64, note, color *string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE highlights
+		SET note = COALESCE(?, note), color = COALESCE(?, color)
+		WHERE id = ? AND article_id = ?
+			AND article_id IN (SELECT id FROM articles WHERE user_id = ?)
+	`, note, color, id, articleID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// DeleteHighlight removes a highlight from one of a user's articles
+func (s *SQLiteDB) DeleteHighlight(ctx context.Context, userID, articleID, id int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM highlights
+		WHERE id = ? AND article_id = ?
+			AND article_id IN (SELECT id FROM articles WHERE user_id = ?)
+	`, id, articleID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// highlightFeed is the sort order cursors of the highlights feed are issued
+// for. The feed is ordered newest first.
+const highlightFeed = "highlights"
+
+var highlightKeys = []sortKey{{"h.created_at", true}, {"h.id", true}}
+
+// ListAllHighlights returns a page of a user's highlights across all
+// articles, newest first, with the title and URL of their article. cursor
+// is the one returned with the previous page, or empty for the first page;
+// the returned cursor is empty on the last page.
+func (s *SQLiteDB) ListAllHighlights(ctx context.Context, userID int64, limit int, cursor string) ([]Highlight, string, error) {
+	p := &pageQuery{sort: highlightFeed, limit: limit, keys: highlightKeys}
+
+	var where whereClause
+	if cursor != "" {
+		c, err := parseCursor(cursor, highlightFeed)
+		if err != nil || len(c.Keys) != len(p.keys) {
+			return nil, "", ErrInvalidCursor
+		}
+		cond, args := after(p.keys, c.Keys)
+		where.add(cond, args...)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+highlightColumns+`, COALESCE(a.title, ''), a.url`+p.columns()+`
+		FROM highlights h
+		JOIN articles a ON a.id = h.article_id
+		WHERE a.user_id = ?`+where.String()+p.orderBy()+`
+		LIMIT ?
+	`, append(append([]interface{}{userID}, where.args...), limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	highlights := []Highlight{}
+	var title, url string
+	values := make([]interface{}, len(p.keys))
+	dest := []interface{}{&title, &url}
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+
+	var last []interface{}
+	for rows.Next() {
+		if len(highlights) == limit {
+			return highlights, p.cursor(last), nil
+		}
+		h, err := scanHighlight(rows, dest...)
+		if err != nil {
+			return nil, "", err
+		}
+		h.ArticleTitle, h.ArticleURL = title, url
+		highlights = append(highlights, *h)
+		last = append(last[:0], values...)
+	}
+	return highlights, "", rows.Err()
+}
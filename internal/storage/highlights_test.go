@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestListAllHighlightsPages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	a1 := newTestArticle(t, db, alice, &Article{URL: "https://example.com/1", Title: "One"})
+	a2 := newTestArticle(t, db, alice, &Article{URL: "https://example.com/2", Title: "Two"})
+	b1 := newTestArticle(t, db, bob, &Article{URL: "https://example.com/b", Title: "Bob's"})
+
+	// Created within the same second, so pages are told apart by ID
+	var want []int64
+	for i := 0; i < 7; i++ {
+		h := &Highlight{ArticleID: a1, Quote: fmt.Sprint(i), Color: "yellow"}
+		if i%2 == 1 {
+			h.ArticleID = a2
+		}
+		if err := db.CreateHighlight(ctx, alice, h); err != nil {
+			t.Fatal(err)
+		}
+		want = append([]int64{h.ID}, want...)
+	}
+	if err := db.CreateHighlight(ctx, bob, &Highlight{ArticleID: b1, Quote: "bob", Color: "yellow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int64
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("paging does not end")
+		}
+		page, next, err := db.ListAllHighlights(ctx, alice, 3, cursor)
+		if err != nil {
+			t.Fatalf("ListAllHighlights: %v", err)
+		}
+		for _, h := range page {
+			got = append(got, h.ID)
+			if h.ArticleTitle == "" || h.ArticleURL == "" {
+				t.Errorf("highlight %d has no article title or URL", h.ID)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("highlights = %v, want %v", got, want)
+	}
+}
+
+func TestListAllHighlightsInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+
+	// A cursor from an article list can't be used for highlights
+	articleCursor := (&pageQuery{sort: SortSavedAt, keys: sortKeys(SortSavedAt, "")}).cursor([]interface{}{"2024-01-01 00:00:00", int64(1)})
+	for _, cursor := range []string{"not base64!", "e30", articleCursor} {
+		if _, _, err := db.ListAllHighlights(ctx, user, 10, cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: err = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
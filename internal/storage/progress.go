@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ReadingProgress is how far a user has got through an article
+type ReadingProgress struct {
+	Percent      float64    `json:"percent"`
+	Offset       int        `json:"offset"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	LastOpenedAt *time.Time `json:"last_opened_at,omitempty"`
+}
+
+// ProgressUpdate is a progress report from a client. UpdatedAt and OpenedAt
+// are the client's clock.
+type ProgressUpdate struct {
+	Percent   *float64
+	Offset    *int
+	UpdatedAt time.Time
+	OpenedAt  *time.Time
+}
+
+// formatProgressTime keeps milliseconds so that updates made in quick
+// succession are ordered correctly
+func formatProgressTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000")
+}
+
+// UpdateProgress records a client's reading progress on one of a user's
+// articles. The position is only changed if the update is newer than the
+// last one applied, so that a device syncing late can't move another
+// device's position backwards; it reports whether the position was applied.
+// Saving progress on an unread article marks it in progress. The
+// last-opened time only ever moves forward.
+func (s *SQLiteDB) UpdateProgress(ctx context.Context, userID, id int64, u ProgressUpdate) (bool, error) {
+	if err := s.checkArticle(ctx, userID, id); err != nil {
+		return false, err
+	}
+
+	applied := false
+	if u.Percent != nil || u.Offset != nil {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE articles
+			SET progress = COALESCE(?, progress), progress_offset = COALESCE(?, progress_offset), progress_at = ?,
+				read_state = CASE
+					WHEN read_state = 'unread' AND COALESCE(?, progress) > 0 THEN 'in_progress'
+					ELSE read_state
+				END
+			WHERE id = ? AND user_id = ? AND (progress_at IS NULL OR progress_at < ?)
+		`, u.Percent, u.Offset, formatProgressTime(u.UpdatedAt), u.Percent, id, userID, formatProgressTime(u.UpdatedAt))
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		applied = n > 0
+	}
+
+	if u.OpenedAt != nil {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE articles SET last_opened_at = ?
+			WHERE id = ? AND user_id = ? AND (last_opened_at IS NULL OR last_opened_at < ?)
+		`, formatProgressTime(*u.OpenedAt), id, userID, formatProgressTime(*u.OpenedAt))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return applied, nil
+}
+
+// GetProgress returns the reading progress of one of a user's articles
+func (s *SQLiteDB) GetProgress(ctx context.Context, userID, id int64) (*ReadingProgress, error) {
+	p := &ReadingProgress{}
+	var updatedAt, lastOpenedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT progress, progress_offset, progress_at, last_opened_at
+		FROM articles WHERE id = ? AND user_id = ?
+	`, id, userID).Scan(&p.Percent, &p.Offset, &updatedAt, &lastOpenedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = nullTime(updatedAt)
+	p.LastOpenedAt = nullTime(lastOpenedAt)
+	return p, nil
+}
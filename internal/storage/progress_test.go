@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateProgressLastWriteWins(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a"})
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	pct := func(p float64) *float64 { return &p }
+	off := func(o int) *int { return &o }
+
+	// Each step is applied to the state left by the ones before it
+	steps := []struct {
+		name        string
+		update      ProgressUpdate
+		wantApplied bool
+		wantPercent float64
+		wantOffset  int
+		wantState   string
+	}{
+		{"first report", ProgressUpdate{Percent: pct(0), Offset: off(0), UpdatedAt: base}, true, 0, 0, ReadStateUnread},
+		{"reading starts", ProgressUpdate{Percent: pct(20), Offset: off(400), UpdatedAt: base.Add(time.Minute)}, true, 20, 400, ReadStateInProgress},
+		{"phone syncs late", ProgressUpdate{Percent: pct(5), Offset: off(100), UpdatedAt: base.Add(30 * time.Second)}, false, 20, 400, ReadStateInProgress},
+		{"same time", ProgressUpdate{Percent: pct(90), Offset: off(1800), UpdatedAt: base.Add(time.Minute)}, false, 20, 400, ReadStateInProgress},
+		{"milliseconds later", ProgressUpdate{Percent: pct(21), Offset: off(420), UpdatedAt: base.Add(time.Minute + time.Millisecond)}, true, 21, 420, ReadStateInProgress},
+		{"offset only", ProgressUpdate{Offset: off(500), UpdatedAt: base.Add(2 * time.Minute)}, true, 21, 500, ReadStateInProgress},
+		{"scrolled back", ProgressUpdate{Percent: pct(10), UpdatedAt: base.Add(3 * time.Minute)}, true, 10, 500, ReadStateInProgress},
+		{"opened only", ProgressUpdate{UpdatedAt: base.Add(4 * time.Minute)}, false, 10, 500, ReadStateInProgress},
+	}
+	for _, tt := range steps {
+		applied, err := db.UpdateProgress(ctx, user, id, tt.update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if applied != tt.wantApplied {
+			t.Errorf("%s: applied = %v, want %v", tt.name, applied, tt.wantApplied)
+		}
+		p, err := db.GetProgress(ctx, user, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Percent != tt.wantPercent || p.Offset != tt.wantOffset {
+			t.Errorf("%s: progress = %v%% at %d, want %v%% at %d", tt.name, p.Percent, p.Offset, tt.wantPercent, tt.wantOffset)
+		}
+		a, err := db.GetArticle(ctx, user, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.ReadState != tt.wantState {
+			t.Errorf("%s: read state = %s, want %s", tt.name, a.ReadState, tt.wantState)
+		}
+	}
+}
+
+func TestUpdateProgressKeepsReadState(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a"})
+
+	read := ReadStateRead
+	if err := db.UpdateArticle(ctx, user, id, ArticleUpdate{ReadState: &read}); err != nil {
+		t.Fatal(err)
+	}
+	percent := 40.0
+	if _, err := db.UpdateProgress(ctx, user, id, ProgressUpdate{Percent: &percent, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.GetArticle(ctx, user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ReadState != ReadStateRead {
+		t.Errorf("read state = %s, want it to stay read", a.ReadState)
+	}
+}
+
+func TestUpdateProgressLastOpened(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a"})
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, opened := range []time.Time{base.Add(time.Hour), base, base.Add(30 * time.Minute)} {
+		if _, err := db.UpdateProgress(ctx, user, id, ProgressUpdate{OpenedAt: &opened, UpdatedAt: opened}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := db.GetProgress(ctx, user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.LastOpenedAt == nil || !p.LastOpenedAt.Equal(base.Add(time.Hour)) {
+		t.Errorf("last opened = %v, want the latest %v", p.LastOpenedAt, base.Add(time.Hour))
+	}
+	if p.UpdatedAt != nil {
+		t.Errorf("updated at = %v, want none without a position", p.UpdatedAt)
+	}
+}
+
+func TestUpdateProgressOtherUser(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	id := newTestArticle(t, db, alice, &Article{URL: "https://example.com/a"})
+
+	percent := 50.0
+	if _, err := db.UpdateProgress(ctx, bob, id, ProgressUpdate{Percent: &percent, UpdatedAt: time.Now()}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateProgress by another user: err = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetProgress(ctx, bob, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetProgress by another user: err = %v, want ErrNotFound", err)
+	}
+}
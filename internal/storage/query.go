@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued for the
+// requested sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders for article lists. Each has a natural direction: newest,
+// A to Z or shortest first.
+const (
+	SortSavedAt     = "saved_at"
+	SortFavoritedAt = "favorited_at"
+	SortTitle       = "title"
+	SortReadingTime = "reading_time"
+	SortRandom      = "random"
+	// SortRelevance is the default for search and only valid there
+	SortRelevance = "relevance"
+)
+
+// IsSort reports whether s is a sort order for article lists
+func IsSort(s string) bool {
+	switch s {
+	case SortSavedAt, SortFavoritedAt, SortTitle, SortReadingTime, SortRandom:
+		return true
+	}
+	return false
+}
+
+// Filter narrows an article list or search. Nil and zero fields don't
+// filter.
+type Filter struct {
+	Archived  *bool
+	ReadState string
+	Favorite  *bool
+
+	// Articles must have every tag in AllTags, at least one of AnyTags and
+	// none of NotTags
+	AllTags []string
+	AnyTags []string
+	NotTags []string
+
+	// Domain matches the site an article was saved from, including its
+	// subdomains
+	Domain string
+	// Author matches part of the author's name, ignoring case
+	Author string
+
+	// SavedAfter is inclusive and SavedBefore exclusive
+	SavedAfter  time.Time
+	SavedBefore time.Time
+
+	MinWords int
+	MaxWords int
+}
+
+// ListOptions filters, orders and pages an article list
+type ListOptions struct {
+	Filter
+	// Sort is SortSavedAt by default for lists and SortRelevance for search.
+	// Sorting by SortFavoritedAt puts articles that were never starred last.
+	Sort  string
+	Limit int
+	// Cursor is the next_cursor of the previous page, or empty for the first
+	// page. Random order has a single page.
+	Cursor string
+	// Ranking scores search results; nil uses DefaultRanking
+	Ranking *Ranking
+}
+
+// whereClause accumulates the conditions of an article query on the
+// articles table aliased as a
+type whereClause struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *whereClause) add(cond string, args ...interface{}) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// String joins the conditions with AND, prefixed with AND so that it can
+// follow the user condition
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(w.conds, " AND ")
+}
+
+// tagCondition matches articles with a tag among names
+func tagCondition(names []string) string {
+	return `EXISTS (
+		SELECT 1 FROM article_tags at JOIN tags t ON t.id = at.tag_id
+		WHERE at.article_id = a.id AND t.name IN (` + placeholders(len(names)) + `))`
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// domainCondition matches articles from a domain or its subdomains. It takes
+// the domain three times.
+const domainCondition = "(a.domain = ? OR substr(a.domain, -length(?) - 1) = '.' || ?)"
+
+// apply adds the filter's conditions to w
+func (f *Filter) apply(w *whereClause) {
+	if f.Archived != nil {
+		w.add("a.archived = ?", boolInt(*f.Archived))
+	}
+	if f.ReadState != "" {
+		w.add("a.read_state = ?", f.ReadState)
+	}
+	if f.Favorite != nil {
+		w.add("a.favorite = ?", boolInt(*f.Favorite))
+	}
+
+	for _, tag := range f.AllTags {
+		w.add(tagCondition([]string{tag}), tag)
+	}
+	if len(f.AnyTags) > 0 {
+		w.add(tagCondition(f.AnyTags), stringArgs(f.AnyTags)...)
+	}
+	if len(f.NotTags) > 0 {
+		w.add("NOT "+tagCondition(f.NotTags), stringArgs(f.NotTags)...)
+	}
+
+	if domain := normalizeDomain(f.Domain); domain != "" {
+		w.add(domainCondition, domain, domain, domain)
+	}
+	if f.Author != "" {
+		w.add(`a.author LIKE ? ESCAPE '\'`, "%"+escapeLike(f.Author)+"%")
+	}
+
+	if !f.SavedAfter.IsZero() {
+		w.add("a.saved_at >= ?", formatTime(f.SavedAfter))
+	}
+	if !f.SavedBefore.IsZero() {
+		w.add("a.saved_at < ?", formatTime(f.SavedBefore))
+	}
+
+	if f.MinWords > 0 {
+		w.add("a.word_count >= ?", f.MinWords)
+	}
+	if f.MaxWords > 0 {
+		w.add("a.word_count <= ?", f.MaxWords)
+	}
+}
+
+// sortKey is an expression an article list is ordered by
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// sortKeys returns the keys of a sort order. Every order ends with the saved
+// time and ID, so rows have a unique position that cursors can point at.
+// score is the expression search results are ordered by for SortRelevance.
+func sortKeys(sort, score string) []sortKey {
+	tail := []sortKey{{"a.saved_at", true}, {"a.id", true}}
+	switch sort {
+	case SortFavoritedAt:
+		return append([]sortKey{{"COALESCE(a.favorited_at, '')", true}}, tail...)
+	case SortTitle:
+		return append([]sortKey{{"a.title COLLATE NOCASE", false}}, tail...)
+	case SortReadingTime:
+		return append([]sortKey{{"a.word_count", false}}, tail...)
+	case SortRelevance:
+		return append([]sortKey{{score, true}}, tail...)
+	case SortRandom:
+		return []sortKey{{"RANDOM()", false}}
+	default:
+		return tail
+	}
+}
+
+// after returns the condition for rows that come after the given key values
+// in the sort order
+func after(keys []sortKey, values []interface{}) (string, []interface{}) {
+	op := " > ?"
+	if keys[0].desc {
+		op = " < ?"
+	}
+	if len(keys) == 1 {
+		return keys[0].expr + op, values[:1]
+	}
+	rest, restArgs := after(keys[1:], values[1:])
+	cond := "(" + keys[0].expr + op + " OR (" + keys[0].expr + " = ? AND " + rest + "))"
+	return cond, append([]interface{}{values[0], values[0]}, restArgs...)
+}
+
+type cursor struct {
+	Sort string        `json:"s"`
+	Keys []interface{} `json:"k"`
+	At   int64         `json:"at,omitempty"`
+}
+
+// parseCursor decodes a cursor issued for a sort order
+func parseCursor(raw, sort string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// pageQuery orders and pages a query
+type pageQuery struct {
+	sort  string
+	limit int
+	keys  []sortKey
+	// at is the time search scores measure recency from. It is kept in the
+	// cursor so that scores don't change from one page to the next.
+	at time.Time
+}
+
+// page adds the condition for rows after opts.Cursor to w. score returns the
+// expression search results are ranked by at a time; it is nil for lists.
+func (opts *ListOptions) page(w *whereClause, score func(at time.Time) string) (*pageQuery, error) {
+	p := &pageQuery{sort: opts.Sort, limit: opts.Limit, at: time.Now().UTC().Truncate(time.Second)}
+
+	var c cursor
+	if opts.Cursor != "" {
+		var err error
+		if c, err = parseCursor(opts.Cursor, opts.Sort); err != nil || opts.Sort == SortRandom {
+			return nil, ErrInvalidCursor
+		}
+		if c.At != 0 {
+			p.at = time.Unix(c.At, 0).UTC()
+		}
+	}
+
+	if score != nil {
+		p.keys = sortKeys(opts.Sort, score(p.at))
+	} else {
+		p.keys = sortKeys(opts.Sort, "")
+	}
+
+	if opts.Cursor != "" {
+		if len(c.Keys) != len(p.keys) {
+			return nil, ErrInvalidCursor
+		}
+		cond, args := after(p.keys, c.Keys)
+		w.add(cond, args...)
+	}
+	return p, nil
+}
+
+// columns selects the sort keys after the other result columns, so that the
+// cursor for the next page can be built from the last row
+func (p *pageQuery) columns() string {
+	var b strings.Builder
+	for _, k := range p.keys {
+		b.WriteString(", ")
+		b.WriteString(k.expr)
+	}
+	return b.String()
+}
+
+func (p *pageQuery) orderBy() string {
+	terms := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		terms[i] = k.expr
+		if k.desc {
+			terms[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// cursor returns an opaque cursor for the position after a row with the
+// given sort key values
+func (p *pageQuery) cursor(values []interface{}) string {
+	c := cursor{Sort: p.sort, Keys: make([]interface{}, len(values))}
+	for i, v := range values {
+		// Compare with stored timestamps as text, the way they were written
+		switch t := v.(type) {
+		case time.Time:
+			v = formatTime(t)
+		case []byte:
+			v = string(t)
+		}
+		c.Keys[i] = v
+	}
+	if p.sort == SortRelevance {
+		c.At = p.at.Unix()
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// read scans up to the limit of rows of summaryColumns, extra columns and
+// the sort keys. Queries select one row more than the limit to tell whether
+// there is a next page; the returned cursor is empty on the last one. each,
+// if set, is called for every article after its row has been scanned.
+func (p *pageQuery) read(rows *sql.Rows, each func(*Article), extra ...interface{}) ([]Article, string, error) {
+	articles := []Article{}
+	values := make([]interface{}, len(p.keys))
+	dest := append([]interface{}{}, extra...)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+
+	var last []interface{}
+	for rows.Next() {
+		if len(articles) == p.limit {
+			if p.sort == SortRandom {
+				return articles, "", nil
+			}
+			return articles, p.cursor(last), nil
+		}
+
+		a, err := scanSummary(rows, dest...)
+		if err != nil {
+			return nil, "", err
+		}
+		if each != nil {
+			each(&a)
+		}
+		articles = append(articles, a)
+		last = append(last[:0], values...)
+	}
+
+	return articles, "", rows.Err()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// normalizeDomain lower-cases a host name and drops a leading "www."
+func normalizeDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// articleDomain returns the domain an article URL belongs to, or "" if it
+// can't be parsed
+func articleDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return normalizeDomain(u.Hostname())
+}
+
+// countWords counts the whitespace-separated words of an article's text,
+// which reading time is estimated from
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
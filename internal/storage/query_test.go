@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []sortKey
+		values   []interface{}
+		wantCond string
+		wantArgs []interface{}
+	}{
+		{
+			"one key ascending",
+			[]sortKey{{"a.id", false}},
+			[]interface{}{int64(5)},
+			"a.id > ?",
+			[]interface{}{int64(5)},
+		},
+		{
+			"one key descending",
+			[]sortKey{{"a.id", true}},
+			[]interface{}{int64(5)},
+			"a.id < ?",
+			[]interface{}{int64(5)},
+		},
+		{
+			"saved time and ID",
+			[]sortKey{{"a.saved_at", true}, {"a.id", true}},
+			[]interface{}{"2024-01-02 03:04:05", int64(7)},
+			"(a.saved_at < ? OR (a.saved_at = ? AND a.id < ?))",
+			[]interface{}{"2024-01-02 03:04:05", "2024-01-02 03:04:05", int64(7)},
+		},
+		{
+			"mixed directions",
+			[]sortKey{{"a.title COLLATE NOCASE", false}, {"a.saved_at", true}, {"a.id", true}},
+			[]interface{}{"Go", "2024-01-02 03:04:05", int64(7)},
+			"(a.title COLLATE NOCASE > ? OR (a.title COLLATE NOCASE = ? AND (a.saved_at < ? OR (a.saved_at = ? AND a.id < ?))))",
+			[]interface{}{"Go", "Go", "2024-01-02 03:04:05", "2024-01-02 03:04:05", int64(7)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, args := after(tt.keys, tt.values)
+			if cond != tt.wantCond {
+				t.Errorf("cond = %s\nwant   %s", cond, tt.wantCond)
+			}
+			if fmt.Sprint(args) != fmt.Sprint(tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	p := &pageQuery{sort: SortTitle, keys: sortKeys(SortTitle, "")}
+	valid := p.cursor([]interface{}{"Go", "2024-01-02 03:04:05", int64(7)})
+
+	c, err := parseCursor(valid, SortTitle)
+	if err != nil {
+		t.Fatalf("parseCursor: %v", err)
+	}
+	if fmt.Sprint(c.Keys) != "[Go 2024-01-02 03:04:05 7]" {
+		t.Errorf("keys = %v", c.Keys)
+	}
+
+	for _, tt := range []struct {
+		name, raw, sort string
+	}{
+		{"other sort", valid, SortSavedAt},
+		{"not base64", "%%%", SortTitle},
+		{"not JSON", "bm90IGpzb24", SortTitle},
+		{"empty object", "e30", SortTitle},
+	} {
+		if _, err := parseCursor(tt.raw, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+func TestListArticlesPages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	other := newTestUser(t, db, "bob")
+	newTestArticle(t, db, other, &Article{URL: "https://example.com/bob", Title: "Bob's"})
+
+	// Titles, lengths and times repeat so that pages must be told apart by
+	// the later keys
+	for i := 0; i < 11; i++ {
+		id := newTestArticle(t, db, user, &Article{
+			URL:         fmt.Sprint("https://example.com/", i),
+			Title:       []string{"apple", "Banana", "cherry"}[i%3],
+			TextContent: strings.Repeat("word ", i%4),
+		})
+		_, err := db.db.Exec("UPDATE articles SET saved_at = ?, archived = ? WHERE id = ?",
+			fmt.Sprintf("2024-01-0%d 00:00:00", 1+i%5), i%2, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			_, err := db.db.Exec("UPDATE articles SET favorite = 1, favorited_at = ? WHERE id = ?",
+				fmt.Sprintf("2024-02-0%d 00:00:00", 1+i%2), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	archived := false
+	for _, tt := range []struct {
+		name string
+		opts ListOptions
+	}{
+		{"saved", ListOptions{Sort: SortSavedAt}},
+		{"favorited", ListOptions{Sort: SortFavoritedAt}},
+		{"title", ListOptions{Sort: SortTitle}},
+		{"reading time", ListOptions{Sort: SortReadingTime}},
+		{"filtered", ListOptions{Sort: SortTitle, Filter: Filter{Archived: &archived}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			all := tt.opts
+			all.Limit = 100
+			want, next, err := db.ListArticles(ctx, user, all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next != "" {
+				t.Errorf("single page has a next cursor")
+			}
+			if len(want) < 5 {
+				t.Fatalf("listed %d articles", len(want))
+			}
+
+			var got []Article
+			opts := tt.opts
+			opts.Limit = 2
+			for pages := 0; ; pages++ {
+				if pages > len(want) {
+					t.Fatal("paging does not end")
+				}
+				page, next, err := db.ListArticles(ctx, user, opts)
+				if err != nil {
+					t.Fatalf("page %d: %v", pages, err)
+				}
+				got = append(got, page...)
+				if next == "" {
+					break
+				}
+				opts.Cursor = next
+			}
+
+			if ids(got) != ids(want) {
+				t.Errorf("paged = %s\n  want %s", ids(got), ids(want))
+			}
+		})
+	}
+
+	// A cursor is only valid for the order it was issued for
+	_, next, err := db.ListArticles(ctx, user, ListOptions{Sort: SortTitle, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sort := range []string{SortSavedAt, SortRandom} {
+		if _, _, err := db.ListArticles(ctx, user, ListOptions{Sort: sort, Limit: 2, Cursor: next}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("title cursor with %s: err = %v, want ErrInvalidCursor", sort, err)
+		}
+	}
+}
+
+func ids(articles []Article) string {
+	var b strings.Builder
+	for _, a := range articles {
+		fmt.Fprint(&b, a.ID, " ")
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnWeights weighs a match in each indexed article column against a
+// match in the text
+type ColumnWeights struct {
+	Title   float64
+	Text    float64
+	Author  float64
+	Excerpt float64
+	Domain  float64
+	// Highlight weighs a match in the quote or note of one of the
+	// article's highlights
+	Highlight float64
+}
+
+// Ranking is how search results are scored for SortRelevance. The score is
+// the BM25 relevance of the match, raised for recently saved articles and
+// scaled by ArchivedWeight for archived ones.
+type Ranking struct {
+	Weights ColumnWeights
+	// RecencyBoost is how much an article saved just now is raised, as a
+	// fraction of its relevance. The boost is halved for an article
+	// RecencyHalfLife old and keeps falling, more slowly, after that.
+	RecencyBoost    float64
+	RecencyHalfLife time.Duration
+	// ArchivedWeight multiplies the score of archived articles; below 1
+	// demotes them
+	ArchivedWeight float64
+}
+
+// DefaultRanking favors matches in the title and author, boosts articles
+// saved in the last few months and treats archived articles like the rest
+var DefaultRanking = Ranking{
+	Weights:         ColumnWeights{Title: 10, Text: 1, Author: 5, Excerpt: 2, Domain: 3, Highlight: 1},
+	RecencyBoost:    0.5,
+	RecencyHalfLife: 90 * 24 * time.Hour,
+	ArchivedWeight:  1,
+}
+
+// sqlFloat formats f as an SQL literal. Ranking values are inlined rather
+// than bound because the score appears in the select list, the cursor
+// condition and ORDER BY of a query.
+func sqlFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// rank returns the bm25() call ranking articles_fts matches, in the order of
+// the index's columns. Like rank, better matches are more negative.
+func (w ColumnWeights) rank() string {
+	return "bm25(articles_fts, " + sqlFloat(w.Title) + ", " + sqlFloat(w.Text) + ", " +
+		sqlFloat(w.Author) + ", " + sqlFloat(w.Excerpt) + ", " + sqlFloat(w.Domain) + ")"
+}
+
+// highlightRank returns the bm25() call ranking highlights_fts matches on the
+// same scale as rank, so that the two can be compared
+func (w ColumnWeights) highlightRank() string {
+	return "bm25(highlights_fts, " + sqlFloat(w.Highlight) + ", " + sqlFloat(w.Highlight) + ")"
+}
+
+// score returns the expression scoring a search result, with the rank of
+// the match source m, with recency measured from at. The boost decays
+// hyperbolically, as SQLite may be built without pow().
+func (r *Ranking) score(at time.Time) string {
+	halfLife := r.RecencyHalfLife.Hours() / 24
+	if halfLife <= 0 {
+		halfLife = DefaultRanking.RecencyHalfLife.Hours() / 24
+	}
+	age := "MAX(0.0, julianday('" + formatTime(at) + "') - julianday(a.saved_at))"
+
+	return "(-m.rank * (1.0 + " + sqlFloat(r.RecencyBoost) + " / (1.0 + " + age + " / " + sqlFloat(halfLife) + "))" +
+		" * CASE WHEN a.archived = 1 THEN " + sqlFloat(r.ArchivedWeight) + " ELSE 1.0 END)"
+}
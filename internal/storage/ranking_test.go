@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// searchIDs returns the IDs of a search's results in order, and their scores
+func searchIDs(t *testing.T, db *SQLiteDB, userID int64, query string, ranking *Ranking) ([]int64, []float64) {
+	t.Helper()
+	articles, _, err := db.Search(context.Background(), userID, ParseSearchQuery(query), ListOptions{Limit: 10, Ranking: ranking})
+	if err != nil {
+		t.Fatalf("Search(%q): %v", query, err)
+	}
+	var ids []int64
+	var scores []float64
+	for _, a := range articles {
+		ids = append(ids, a.ID)
+		scores = append(scores, *a.Score)
+	}
+	return ids, scores
+}
+
+func setSavedAt(t *testing.T, db *SQLiteDB, id int64, savedAt time.Time) {
+	t.Helper()
+	if _, err := db.db.Exec("UPDATE articles SET saved_at = ? WHERE id = ?", formatTime(savedAt), id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchColumnWeights(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	inTitle := newTestArticle(t, db, user, &Article{URL: "https://example.com/a", Title: "Kubernetes operators",
+		TextContent: "Writing controllers that reconcile cluster state."})
+	inText := newTestArticle(t, db, user, &Article{URL: "https://example.com/b", Title: "Controllers",
+		TextContent: "Writing kubernetes controllers that reconcile cluster state."})
+	byAuthor := newTestArticle(t, db, user, &Article{URL: "https://example.com/c", Title: "Operators", Author: "Kubernetes Team",
+		TextContent: "Writing controllers that reconcile cluster state."})
+
+	ids, _ := searchIDs(t, db, user, "kubernetes", nil)
+	if want := []int64{inTitle, byAuthor, inText}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("default weights: ids = %v, want %v (title, author, text)", ids, want)
+	}
+
+	textFirst := DefaultRanking
+	textFirst.Weights = ColumnWeights{Title: 1, Text: 20, Author: 1, Excerpt: 1, Domain: 1}
+	if ids, _ := searchIDs(t, db, user, "kubernetes", &textFirst); len(ids) != 3 || ids[0] != inText {
+		t.Errorf("text weighted highest: ids = %v, want %d first", ids, inText)
+	}
+}
+
+func TestSearchRecencyBoost(t *testing.T) {
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	now := time.Now().UTC()
+
+	// The same text, so only the saved time tells them apart
+	save := func(url string, age time.Duration) int64 {
+		id := newTestArticle(t, db, user, &Article{URL: url, Title: "Sourdough", TextContent: "A sourdough starter guide."})
+		setSavedAt(t, db, id, now.Add(-age))
+		return id
+	}
+	old := save("https://example.com/old", 365*24*time.Hour)
+	halfLife := save("https://example.com/half-life", 90*24*time.Hour)
+	recent := save("https://example.com/recent", 0)
+
+	ids, scores := searchIDs(t, db, user, "sourdough", nil)
+	if want := []int64{recent, halfLife, old}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("ids = %v, want %v (newest first)", ids, want)
+	}
+
+	// An article saved just now gets the full boost of 0.5 and one saved
+	// a half-life ago half of it
+	if ratio := scores[0] / scores[1]; math.Abs(ratio-1.5/1.25) > 1e-3 {
+		t.Errorf("score of a new article / one a half-life old = %v, want %v", ratio, 1.5/1.25)
+	}
+	wantOld := 1 + 0.5/(1+365.0/90)
+	if ratio := scores[0] / scores[2]; math.Abs(ratio-1.5/wantOld) > 1e-3 {
+		t.Errorf("score of a new article / one a year old = %v, want %v", ratio, 1.5/wantOld)
+	}
+
+	// Without the boost all three score the same
+	flat := DefaultRanking
+	flat.RecencyBoost = 0
+	_, scores = searchIDs(t, db, user, "sourdough", &flat)
+	for _, s := range scores[1:] {
+		if math.Abs(s-scores[0]) > 1e-9 {
+			t.Errorf("scores without a recency boost = %v, want all equal", scores)
+			break
+		}
+	}
+
+	// A shorter half-life widens the gap
+	short := DefaultRanking
+	short.RecencyHalfLife = 7 * 24 * time.Hour
+	_, shortScores := searchIDs(t, db, user, "sourdough", &short)
+	_, defaultScores := searchIDs(t, db, user, "sourdough", nil)
+	if shortScores[0]/shortScores[1] <= defaultScores[0]/defaultScores[1] {
+		t.Errorf("a 7 day half-life doesn't favor new articles more than the default")
+	}
+}
+
+func TestSearchArchivedWeight(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	now := time.Now().UTC()
+
+	active := newTestArticle(t, db, user, &Article{URL: "https://example.com/a", Title: "Espresso", TextContent: "Dialing in espresso."})
+	archived := newTestArticle(t, db, user, &Article{URL: "https://example.com/b", Title: "Espresso", TextContent: "Dialing in espresso."})
+	setSavedAt(t, db, active, now.Add(-30*24*time.Hour))
+	setSavedAt(t, db, archived, now)
+	isArchived := true
+	if err := db.UpdateArticle(ctx, user, archived, ArticleUpdate{Archived: &isArchived}); err != nil {
+		t.Fatal(err)
+	}
+
+	// By default archived articles aren't demoted, so the newer one wins
+	ids, _ := searchIDs(t, db, user, "espresso", nil)
+	if want := []int64{archived, active}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("default: ids = %v, want %v", ids, want)
+	}
+
+	demoted := DefaultRanking
+	demoted.ArchivedWeight = 0.5
+	ids, scores := searchIDs(t, db, user, "espresso", &demoted)
+	if want := []int64{active, archived}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("archived weight 0.5: ids = %v, want %v", ids, want)
+	}
+	if len(scores) == 2 && scores[1] >= scores[0] {
+		t.Errorf("archived score %v isn't below %v", scores[1], scores[0])
+	}
+}
+
+func TestSearchHighlightWeight(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	inTitle := newTestArticle(t, db, user, &Article{URL: "https://example.com/a", Title: "Kubernetes operators",
+		TextContent: "Writing controllers that reconcile cluster state."})
+	highlighted := newTestArticle(t, db, user, &Article{URL: "https://example.com/b", Title: "Controllers",
+		TextContent: "Writing controllers that reconcile cluster state, with kubernetes doing the scheduling."})
+	other := newTestArticle(t, db, user, &Article{URL: "https://example.com/c", Title: "Espresso", TextContent: "Dialing in espresso."})
+
+	// BM25 gives no weight to a word most of an index matches, so both
+	// indexes need entries that don't match
+	for i := 0; i < 6; i++ {
+		newTestArticle(t, db, user, &Article{URL: fmt.Sprintf("https://example.com/filler/%d", i), Title: "Sourdough",
+			TextContent: "A sourdough starter guide."})
+	}
+	for _, h := range []*Highlight{
+		{ArticleID: highlighted, Quote: "kubernetes doing the scheduling"},
+		{ArticleID: highlighted, Quote: "reconcile cluster state"},
+		{ArticleID: other, Quote: "Dialing in espresso"},
+		{ArticleID: other, Quote: "espresso", Note: "grind finer"},
+	} {
+		h.Color = "yellow"
+		if err := db.CreateHighlight(ctx, user, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, _ := searchIDs(t, db, user, "kubernetes", nil)
+	if want := []int64{inTitle, highlighted}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("default weights: ids = %v, want %v (title match before a highlight in the text)", ids, want)
+	}
+
+	highlightFirst := DefaultRanking
+	highlightFirst.Weights.Title = 1
+	highlightFirst.Weights.Highlight = 10
+	if ids, _ := searchIDs(t, db, user, "kubernetes", &highlightFirst); len(ids) != 2 || ids[0] != highlighted {
+		t.Errorf("highlights weighted highest: ids = %v, want %d first", ids, highlighted)
+	}
+}
+
+func TestColumnWeightsRank(t *testing.T) {
+	w := ColumnWeights{Title: 10, Text: 1, Author: 2.5, Excerpt: 0, Domain: 3}
+	if got, want := w.rank(), "bm25(articles_fts, 10.0, 1.0, 2.5, 0.0, 3.0)"; got != want {
+		t.Errorf("rank = %s, want %s", got, want)
+	}
+	w.Highlight = 2
+	if got, want := w.highlightRank(), "bm25(highlights_fts, 2.0, 2.0)"; got != want {
+		t.Errorf("highlightRank = %s, want %s", got, want)
+	}
+}
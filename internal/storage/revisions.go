@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Revision is an earlier version of an article's content
+type Revision struct {
+	ID          int64     `json:"id"`
+	ArticleID   int64     `json:"article_id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content,omitempty"`
+	TextContent string    `json:"text_content,omitempty"`
+	Excerpt     string    `json:"excerpt,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const revisionColumns = `r.id, r.article_id, COALESCE(r.title, ''), COALESCE(r.content, ''), COALESCE(r.text_content, ''),
+	COALESCE(r.excerpt, ''), COALESCE(r.author, ''), COALESCE(r.image_url, ''), r.created_at`
+
+func scanRevision(row interface{ Scan(...any) error }) (*Revision, error) {
+	r := &Revision{}
+	err := row.Scan(&r.ID, &r.ArticleID, &r.Title, &r.Content, &r.TextContent, &r.Excerpt, &r.Author, &r.ImageURL, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// ListRevisions returns the earlier versions of one of a user's articles,
+// newest first, without their content
+func (s *SQLiteDB) ListRevisions(ctx context.Context, userID, articleID int64) ([]Revision, error) {
+	if err := s.checkArticle(ctx, userID, articleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, article_id, COALESCE(title, ''), created_at
+		FROM article_revisions
+		WHERE article_id = ?
+		ORDER BY id DESC
+	`, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.ID, &r.ArticleID, &r.Title, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns an earlier version of one of a user's articles
+func (s *SQLiteDB) GetRevision(ctx context.Context, userID, articleID, revisionID int64) (*Revision, error) {
+	return scanRevision(s.db.QueryRowContext(ctx, `
+		SELECT `+revisionColumns+`
+		FROM article_revisions r
+		JOIN articles a ON a.id = r.article_id
+		WHERE r.id = ? AND r.article_id = ? AND a.user_id = ?
+	`, revisionID, articleID, userID))
+}
+
+// GetNextRevision returns the version that replaced a revision: the next
+// revision, or the article's current content with a zero ID and time if the
+// revision is the latest
+func (s *SQLiteDB) GetNextRevision(ctx context.Context, userID, articleID, revisionID int64) (*Revision, error) {
+	next, err := scanRevision(s.db.QueryRowContext(ctx, `
+		SELECT `+revisionColumns+`
+		FROM article_revisions r
+		JOIN articles a ON a.id = r.article_id
+		WHERE r.id > ? AND r.article_id = ? AND a.user_id = ?
+		ORDER BY r.id
+		LIMIT 1
+	`, revisionID, articleID, userID))
+	if err != ErrNotFound {
+		return next, err
+	}
+
+	current := &Revision{ArticleID: articleID}
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(title, ''), COALESCE(content, ''), COALESCE(text_content, ''),
+			COALESCE(excerpt, ''), COALESCE(author, ''), COALESCE(image_url, '')
+		FROM articles
+		WHERE id = ? AND user_id = ?
+	`, articleID, userID).Scan(&current.Title, &current.Content, &current.TextContent, &current.Excerpt, &current.Author, &current.ImageURL)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
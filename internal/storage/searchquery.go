@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a parsed search string. Words and phrases are matched
+// against the full-text index; tag: and site: narrow the results like
+// filters.
+type SearchQuery struct {
+	terms    []searchTerm
+	tags     []string
+	notTags  []string
+	sites    []string
+	notSites []string
+}
+
+type searchTerm struct {
+	// column is "title" or "author", or empty to match any indexed column
+	column  string
+	text    string
+	prefix  bool
+	negated bool
+}
+
+// ParseSearchQuery parses a search string. It never fails: anything that
+// isn't syntax is searched for as text. The syntax is
+//
+//	word          articles containing word
+//	"a phrase"    articles containing the words in order
+//	word*         words starting with word
+//	-word         articles without word; works with every form below
+//	title:word    word in the title; also takes a phrase or prefix
+//	author:word   word in the author's name
+//	tag:name      articles with the tag; quote names with spaces
+//	site:host     articles from the site or its subdomains
+func ParseSearchQuery(input string) SearchQuery {
+	var q SearchQuery
+	rest := input
+
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return q
+		}
+
+		negated := false
+		if len(rest) > 1 && rest[0] == '-' && !unicode.IsSpace(rune(rest[1])) {
+			negated = true
+			rest = rest[1:]
+		}
+
+		field := ""
+		if i := strings.IndexByte(rest, ':'); i > 0 {
+			name := strings.ToLower(rest[:i])
+			switch name {
+			case "title", "author", "tag", "site":
+				field = name
+				rest = rest[i+1:]
+			}
+		}
+
+		var text string
+		var prefix bool
+		text, prefix, rest = readSearchValue(rest)
+
+		switch field {
+		case "tag":
+			if text != "" {
+				if negated {
+					q.notTags = append(q.notTags, text)
+				} else {
+					q.tags = append(q.tags, text)
+				}
+			}
+		case "site":
+			if site := normalizeDomain(text); site != "" {
+				if negated {
+					q.notSites = append(q.notSites, site)
+				} else {
+					q.sites = append(q.sites, site)
+				}
+			}
+		default:
+			// Terms without letters or digits have no tokens to match and
+			// would make the whole query match nothing
+			if strings.IndexFunc(text, isWordRune) >= 0 {
+				q.terms = append(q.terms, searchTerm{column: field, text: text, prefix: prefix, negated: negated})
+			}
+		}
+	}
+}
+
+// readSearchValue reads a quoted phrase or a word from the start of s. A
+// trailing * marks a prefix. An unterminated quote runs to the end.
+func readSearchValue(s string) (text string, prefix bool, rest string) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return s[1:], false, ""
+		}
+		text, rest = s[1:end+1], s[end+2:]
+		if strings.HasPrefix(rest, "*") {
+			prefix = true
+			rest = strings.TrimLeft(rest, "*")
+		}
+		return text, prefix, rest
+	}
+
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	text, rest = s[:end], s[end:]
+	if trimmed := strings.TrimRight(text, "*"); trimmed != text {
+		text, prefix = trimmed, true
+	}
+	return text, prefix, rest
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// IsEmpty reports whether the query has nothing to search for
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.terms) == 0 && len(q.tags) == 0 && len(q.notTags) == 0 &&
+		len(q.sites) == 0 && len(q.notSites) == 0
+}
+
+// ftsString quotes text as an FTS5 string, so that it is never read as
+// query syntax
+func ftsString(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+}
+
+func (t searchTerm) fts() string {
+	expr := ftsString(t.text)
+	if t.prefix {
+		expr += "*"
+	}
+	if t.column != "" {
+		expr = t.column + " : " + expr
+	}
+	return expr
+}
+
+// match returns the FTS5 expression all of the query's words must match, or
+// "" if there are none. fielded is false for an index without the title and
+// author columns, which then returns "" for queries using them.
+func (q SearchQuery) match(fielded bool) string {
+	var include []string
+	for _, t := range q.terms {
+		if t.negated {
+			continue
+		}
+		if t.column != "" && !fielded {
+			return ""
+		}
+		include = append(include, t.fts())
+	}
+	return strings.Join(include, " AND ")
+}
+
+// excluded returns the FTS5 expression matching any negated term, or ""
+func (q SearchQuery) excluded() string {
+	var exclude []string
+	for _, t := range q.terms {
+		if t.negated {
+			exclude = append(exclude, t.fts())
+		}
+	}
+	return strings.Join(exclude, " OR ")
+}
+
+// source returns the subquery of matching articles, aliased as m, with one
+// row per article and its snippet and rank, with article columns and
+// highlights weighted by weights. A query without words to match, such as tag:go, selects every
+// article.
+func (q SearchQuery) source(weights ColumnWeights) (string, []interface{}) {
+	articleMatch := q.match(true)
+	if articleMatch == "" {
+		return `(SELECT id, '' AS snippet, 0.0 AS rank FROM articles) m`, nil
+	}
+
+	matches := `
+				SELECT f.rowid AS id, snippet(articles_fts, -1, '<mark>', '</mark>', '...', 32) AS snippet, ` + weights.rank() + ` AS rank
+				FROM articles_fts f
+				WHERE articles_fts MATCH ?`
+	args := []interface{}{articleMatch}
+
+	// Highlights are matched too, unless the query is limited to article
+	// fields that highlights don't have. snippet() can't be used in an
+	// aggregate, so results are only grouped by article when there are
+	// highlight matches to merge.
+	highlightMatch := q.match(false)
+	if highlightMatch == "" {
+		return `(` + matches + `
+		) m`, args
+	}
+
+	matches += `
+				UNION ALL
+				SELECT h.article_id, snippet(highlights_fts, -1, '<mark>', '</mark>', '...', 32), ` + weights.highlightRank() + `
+				FROM highlights_fts hf
+				JOIN highlights h ON h.id = hf.rowid
+				WHERE highlights_fts MATCH ?`
+	args = append(args, highlightMatch)
+
+	return `(
+			SELECT id, snippet, MIN(rank) AS rank
+			FROM (` + matches + `
+			)
+			GROUP BY id
+		) m`, args
+}
+
+// apply adds the conditions of the query's negated words and its tag: and
+// site: terms to w. Articles must have every tag and come from one of the
+// sites.
+func (q SearchQuery) apply(w *whereClause) {
+	if excluded := q.excluded(); excluded != "" {
+		w.add("a.id NOT IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)", excluded)
+	}
+
+	for _, tag := range q.tags {
+		w.add(tagCondition([]string{tag}), tag)
+	}
+	if len(q.notTags) > 0 {
+		w.add("NOT "+tagCondition(q.notTags), stringArgs(q.notTags)...)
+	}
+
+	if len(q.sites) > 0 {
+		conds := make([]string, len(q.sites))
+		var args []interface{}
+		for i, site := range q.sites {
+			conds[i] = domainCondition
+			args = append(args, site, site, site)
+		}
+		w.add("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	for _, site := range q.notSites {
+		w.add("NOT "+domainCondition, site, site, site)
+	}
+}
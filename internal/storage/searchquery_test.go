@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		input    string
+		match    string
+		fielded  string // match against an index without title and author
+		excluded string
+		tags     []string
+		notTags  []string
+		sites    []string
+		notSites []string
+	}{
+		{input: "", match: "", fielded: ""},
+		{input: "   ", match: "", fielded: ""},
+		{input: "go generics", match: `"go" AND "generics"`, fielded: `"go" AND "generics"`},
+		{input: `"type parameters" go`, match: `"type parameters" AND "go"`, fielded: `"type parameters" AND "go"`},
+		{input: "gener*", match: `"gener"*`, fielded: `"gener"*`},
+		{input: `"type param"*`, match: `"type param"*`, fielded: `"type param"*`},
+		{input: "go -rust", match: `"go"`, fielded: `"go"`, excluded: `"rust"`},
+		{input: "-rust -zig", excluded: `"rust" OR "zig"`},
+		{input: "a - b", match: `"a" AND "b"`, fielded: `"a" AND "b"`},
+		{input: "title:go", match: `title : "go"`},
+		{input: `TITLE:"go tour" author:pike*`, match: `title : "go tour" AND author : "pike"*`},
+		{input: "-title:draft go", match: `"go"`, fielded: `"go"`, excluded: `title : "draft"`},
+		{input: "tag:go tag:\"to read\" -tag:done", tags: []string{"go", "to read"}, notTags: []string{"done"}},
+		{input: "site:WWW.Example.com. -site:news.example.com", sites: []string{"example.com"}, notSites: []string{"news.example.com"}},
+		{input: "tag: site:", match: "", fielded: ""},
+		{input: "unknown:field", match: `"unknown:field"`, fielded: `"unknown:field"`},
+		{input: "http://example.com/a", match: `"http://example.com/a"`, fielded: `"http://example.com/a"`},
+		{input: `say "hello`, match: `"say" AND "hello"`, fielded: `"say" AND "hello"`},
+		{input: `a"b`, match: `"a""b"`, fielded: `"a""b"`},
+		{input: "AND OR NOT NEAR(a b)", match: `"AND" AND "OR" AND "NOT" AND "NEAR(a" AND "b)"`, fielded: `"AND" AND "OR" AND "NOT" AND "NEAR(a" AND "b)"`},
+		{input: "* ^ - ... ()", match: "", fielded: ""},
+		{input: "日本語 café", match: `"日本語" AND "café"`, fielded: `"日本語" AND "café"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q := ParseSearchQuery(tt.input)
+			if got := q.match(true); got != tt.match {
+				t.Errorf("match = %s, want %s", got, tt.match)
+			}
+			if got := q.match(false); got != tt.fielded {
+				t.Errorf("match without fields = %s, want %s", got, tt.fielded)
+			}
+			if got := q.excluded(); got != tt.excluded {
+				t.Errorf("excluded = %s, want %s", got, tt.excluded)
+			}
+			for _, list := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"tags", q.tags, tt.tags},
+				{"notTags", q.notTags, tt.notTags},
+				{"sites", q.sites, tt.sites},
+				{"notSites", q.notSites, tt.notSites},
+			} {
+				if fmt.Sprint(list.got) != fmt.Sprint(list.want) {
+					t.Errorf("%s = %q, want %q", list.name, list.got, list.want)
+				}
+			}
+		})
+	}
+}
+
+// Whatever is typed into the search box must never reach FTS5 as syntax
+func TestSearchHostileQueries(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	newTestArticle(t, db, user, &Article{URL: "https://example.com/a", Title: "Go tour", Author: "Rob Pike", TextContent: "generics AND type parameters"})
+
+	for _, input := range []string{
+		`"unbalanced`, `AND`, `OR NOT`, `NEAR(go tour)`, `title:`, `*`, `-`, `go*:`, `{title}: go`,
+		`title:"`, `"" ""`, `^go`, `text_content:go`, `-title:go -author:pike`, `a"b"c`,
+	} {
+		if _, _, err := db.Search(ctx, user, ParseSearchQuery(input), ListOptions{Limit: 10}); err != nil {
+			t.Errorf("Search(%q): %v", input, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		input string
+		want  int
+	}{
+		{"AND", 1},
+		{"title:tour", 1},
+		{"author:pike", 1},
+		{"author:tour", 0},
+		{"gener*", 1},
+		{"go -generics", 0},
+		{"site:example.com", 1},
+		{"-site:example.com", 0},
+	} {
+		got, _, err := db.Search(ctx, user, ParseSearchQuery(tt.input), ListOptions{Limit: 10})
+		if err != nil {
+			t.Errorf("Search(%q): %v", tt.input, err)
+		} else if len(got) != tt.want {
+			t.Errorf("Search(%q) found %d articles, want %d", tt.input, len(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Snapshot kinds
+const (
+	// SnapshotRaw is the page exactly as it was fetched
+	SnapshotRaw = "raw"
+	// SnapshotSingleFile is the page with its stylesheets and images
+	// inlined so it renders without the original site
+	SnapshotSingleFile = "single-file"
+)
+
+// Snapshot is a stored copy of the page an article was extracted from
+type Snapshot struct {
+	Kind string
+	// URL is the page's address after redirects
+	URL       string
+	MediaType string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// SaveSnapshot stores a snapshot of an article's page, replacing any earlier
+// snapshot of the same kind
+func (s *SQLiteDB) SaveSnapshot(ctx context.Context, articleID int64, snap *Snapshot) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO snapshots (article_id, kind, url, media_type, size, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(article_id, kind) DO UPDATE SET
+			url = excluded.url,
+			media_type = excluded.media_type,
+			size = excluded.size,
+			data = excluded.data,
+			created_at = CURRENT_TIMESTAMP
+	`, articleID, snap.Kind, snap.URL, snap.MediaType, len(snap.Data), snap.Data)
+	return err
+}
+
+// GetSnapshot returns a snapshot of one of a user's articles. With an empty
+// kind the single-file snapshot is preferred over the raw page.
+func (s *SQLiteDB) GetSnapshot(ctx context.Context, userID, articleID int64, kind string) (*Snapshot, error) {
+	snap := &Snapshot{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT s.kind, s.url, s.media_type, s.data, s.created_at
+		FROM snapshots s
+		JOIN articles a ON a.id = s.article_id
+		WHERE s.article_id = ? AND a.user_id = ? AND (? = '' OR s.kind = ?)
+		ORDER BY s.kind = ? DESC
+		LIMIT 1
+	`, articleID, userID, kind, kind, SnapshotSingleFile).Scan(&snap.Kind, &snap.URL, &snap.MediaType, &snap.Data, &snap.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
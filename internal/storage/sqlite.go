@@ -1,25 +1,80 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"pocket-clone/internal/canonical"
 )
 
+// ErrNotFound is returned when a row doesn't exist or belongs to another user
+var ErrNotFound = errors.New("not found")
+
+// Article statuses. Articles are saved as pending and updated by the ingest
+// queue once the page has been fetched and parsed.
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Read states. Articles become in progress when reading progress is first
+// saved; read_at is only set while an article is read.
+const (
+	ReadStateUnread     = "unread"
+	ReadStateInProgress = "in_progress"
+	ReadStateRead       = "read"
+)
+
+// IsReadState reports whether s is one of the read states
+func IsReadState(s string) bool {
+	return s == ReadStateUnread || s == ReadStateInProgress || s == ReadStateRead
+}
+
 type Article struct {
-	ID          int64      `json:"id"`
-	URL         string     `json:"url"`
+	ID     int64  `json:"id"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// ErrorKind classifies Error for clients, such as "blocked_address"
+	ErrorKind   string     `json:"error_kind,omitempty"`
 	Title       string     `json:"title"`
 	Content     string     `json:"content"`
 	TextContent string     `json:"text_content,omitempty"`
 	Excerpt     string     `json:"excerpt"`
 	Author      string     `json:"author,omitempty"`
 	ImageURL    string     `json:"image_url,omitempty"`
+	Domain      string     `json:"domain"`
+	WordCount   int        `json:"word_count"`
 	SavedAt     time.Time  `json:"saved_at"`
+	ReadState   string     `json:"read_state"`
 	ReadAt      *time.Time `json:"read_at,omitempty"`
 	Archived    bool       `json:"archived"`
+	Favorite    bool       `json:"favorite"`
+	FavoritedAt *time.Time `json:"favorited_at,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+
+	// CanonicalURL is the address the page gave as its canonical one,
+	// PublishedAt the publication time found on it and Extractor what
+	// extracted the content, such as "readability" or a site rule
+	CanonicalURL string     `json:"canonical_url,omitempty"`
+	PublishedAt  *time.Time `json:"published_at,omitempty"`
+	Extractor    string     `json:"extractor,omitempty"`
+
+	// Progress is the percentage of the article read and ProgressOffset
+	// the matching character offset into TextContent
+	Progress       float64    `json:"progress"`
+	ProgressOffset int        `json:"progress_offset"`
+	ProgressAt     *time.Time `json:"progress_at,omitempty"`
+	LastOpenedAt   *time.Time `json:"last_opened_at,omitempty"`
+
+	// Score is the relevance of a search result; higher is better
+	Score *float64 `json:"score,omitempty"`
 }
 
 type Tag struct {
@@ -31,8 +86,16 @@ type SQLiteDB struct {
 	db *sql.DB
 }
 
+// NewSQLiteDB opens a database file. path may be a file: URI with options
+// of its own, such as an in-memory database.
 func NewSQLiteDB(path string) (*SQLiteDB, error) {
-	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	// The busy timeout lets ingest workers and request handlers write
+	// concurrently without failing on a locked database.
+	db, err := sql.Open("sqlite3", path+sep+"_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
@@ -48,61 +111,439 @@ func (s *SQLiteDB) Close() error {
 	return s.db.Close()
 }
 
+// migrations are applied in order and tracked with PRAGMA user_version, so
+// every entry runs exactly once per database. Append new entries at the end;
+// never edit or reorder ones that have already shipped. The first entries
+// predate versioning and must stay idempotent for existing databases.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS articles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT UNIQUE NOT NULL,
+		title TEXT,
+		content TEXT,
+		text_content TEXT,
+		excerpt TEXT,
+		author TEXT,
+		image_url TEXT,
+		saved_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		read_at DATETIME,
+		archived INTEGER DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS article_tags (
+		article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
+		tag_id INTEGER REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (article_id, tag_id)
+	)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(
+		title, text_content, content='articles', content_rowid='id'
+	)`,
+	// Triggers to keep FTS in sync
+	`CREATE TRIGGER IF NOT EXISTS articles_ai AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS articles_ad AFTER DELETE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS articles_au AFTER UPDATE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
+		INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
+	END`,
+	// Ingestion status
+	`ALTER TABLE articles ADD COLUMN status TEXT NOT NULL DEFAULT 'ready'`,
+	`ALTER TABLE articles ADD COLUMN fetch_error TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS idx_articles_status ON articles(status)`,
+	// Multi-user: articles and tags belong to a user, and URLs and tag names
+	// are only unique per user. Rows saved before accounts existed have a
+	// NULL user_id until the first account claims them.
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE articles_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		title TEXT,
+		content TEXT,
+		text_content TEXT,
+		excerpt TEXT,
+		author TEXT,
+		image_url TEXT,
+		saved_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		read_at DATETIME,
+		archived INTEGER DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'ready',
+		fetch_error TEXT NOT NULL DEFAULT '',
+		UNIQUE (user_id, url)
+	);
+	INSERT INTO articles_new (id, url, title, content, text_content, excerpt, author, image_url,
+		saved_at, read_at, archived, status, fetch_error)
+	SELECT id, url, title, content, text_content, excerpt, author, image_url,
+		saved_at, read_at, archived, status, fetch_error
+	FROM articles;
+	DROP TABLE articles;
+	ALTER TABLE articles_new RENAME TO articles;
+	CREATE INDEX idx_articles_status ON articles(status);
+	CREATE INDEX idx_articles_user_saved ON articles(user_id, saved_at);
+	CREATE TRIGGER articles_ai AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
+	END;
+	CREATE TRIGGER articles_ad AFTER DELETE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
+	END;
+	CREATE TRIGGER articles_au AFTER UPDATE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
+		INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
+	END`,
+	`CREATE TABLE tags_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		UNIQUE (user_id, name)
+	);
+	INSERT INTO tags_new (id, name) SELECT id, name FROM tags;
+	DROP TABLE tags;
+	ALTER TABLE tags_new RENAME TO tags`,
+	// Personal API tokens, stored as SHA-256 hashes
+	`CREATE TABLE api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	)`,
+	// Archived images, deduplicated by the SHA-256 of their content. An
+	// asset is deleted once no article references it.
+	`CREATE TABLE assets (
+		hash TEXT PRIMARY KEY,
+		media_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE article_assets (
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		hash TEXT NOT NULL REFERENCES assets(hash),
+		original_url TEXT NOT NULL,
+		PRIMARY KEY (article_id, hash)
+	);
+	CREATE INDEX idx_article_assets_hash ON article_assets(hash);
+	CREATE TRIGGER article_assets_ad AFTER DELETE ON article_assets BEGIN
+		DELETE FROM assets WHERE hash = old.hash
+			AND NOT EXISTS (SELECT 1 FROM article_assets WHERE hash = old.hash);
+	END`,
+	// Snapshots of the page an article was extracted from, at most one per
+	// kind
+	`CREATE TABLE snapshots (
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL,
+		media_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (article_id, kind)
+	)`,
+	// Earlier versions of an article's content, kept when it is refreshed
+	`CREATE TABLE article_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		title TEXT,
+		content TEXT,
+		text_content TEXT,
+		excerpt TEXT,
+		author TEXT,
+		image_url TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_article_revisions_article ON article_revisions(article_id)`,
+	// Every change to a fetched article's title or content keeps the
+	// version it replaces, whether it was refreshed or edited
+	`CREATE TRIGGER articles_revision AFTER UPDATE OF title, content ON articles
+	WHEN old.status = 'ready' AND (old.title IS NOT new.title OR old.content IS NOT new.content)
+	BEGIN
+		INSERT INTO article_revisions (article_id, title, content, text_content, excerpt, author, image_url)
+		VALUES (old.id, old.title, old.content, old.text_content, old.excerpt, old.author, old.image_url);
+	END`,
+	// Highlights and their notes. Offsets count characters in the article's
+	// text_content; the quote, prefix and suffix let clients re-anchor a
+	// highlight after the text changes.
+	`CREATE TABLE highlights (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		quote TEXT NOT NULL,
+		prefix TEXT NOT NULL DEFAULT '',
+		suffix TEXT NOT NULL DEFAULT '',
+		start_offset INTEGER,
+		end_offset INTEGER,
+		note TEXT NOT NULL DEFAULT '',
+		color TEXT NOT NULL DEFAULT 'yellow',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_highlights_article ON highlights(article_id);
+	CREATE VIRTUAL TABLE highlights_fts USING fts5(
+		quote, note, content='highlights', content_rowid='id'
+	);
+	CREATE TRIGGER highlights_ai AFTER INSERT ON highlights BEGIN
+		INSERT INTO highlights_fts(rowid, quote, note) VALUES (new.id, new.quote, new.note);
+	END;
+	CREATE TRIGGER highlights_ad AFTER DELETE ON highlights BEGIN
+		INSERT INTO highlights_fts(highlights_fts, rowid, quote, note) VALUES('delete', old.id, old.quote, old.note);
+	END;
+	CREATE TRIGGER highlights_au AFTER UPDATE ON highlights BEGIN
+		INSERT INTO highlights_fts(highlights_fts, rowid, quote, note) VALUES('delete', old.id, old.quote, old.note);
+		INSERT INTO highlights_fts(rowid, quote, note) VALUES (new.id, new.quote, new.note);
+	END`,
+	// Reading progress. progress_at is the client's time of the last
+	// accepted update, kept to the millisecond for last-write-wins. Progress
+	// is saved often, so the FTS trigger now only fires when indexed columns
+	// change.
+	`ALTER TABLE articles ADD COLUMN progress REAL NOT NULL DEFAULT 0;
+	ALTER TABLE articles ADD COLUMN progress_offset INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE articles ADD COLUMN progress_at DATETIME;
+	ALTER TABLE articles ADD COLUMN last_opened_at DATETIME;
+	DROP TRIGGER articles_au;
+	CREATE TRIGGER articles_au AFTER UPDATE OF title, text_content ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
+		INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
+	END`,
+	// Read state: unread, in_progress or read
+	`ALTER TABLE articles ADD COLUMN read_state TEXT NOT NULL DEFAULT 'unread';
+	UPDATE articles SET read_state = CASE
+		WHEN read_at IS NOT NULL THEN 'read'
+		WHEN progress > 0 THEN 'in_progress'
+		ELSE 'unread'
+	END;
+	CREATE INDEX idx_articles_user_read_state ON articles(user_id, read_state)`,
+	// Favorites
+	`ALTER TABLE articles ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE articles ADD COLUMN favorited_at DATETIME;
+	CREATE INDEX idx_articles_user_favorited ON articles(user_id, favorite, favorited_at)`,
+	// Columns to filter and sort on; fillDerivedColumns computes them for
+	// existing articles
+	`ALTER TABLE articles ADD COLUMN word_count INTEGER;
+	ALTER TABLE articles ADD COLUMN domain TEXT;
+	CREATE INDEX idx_articles_user_domain ON articles(user_id, domain)`,
+	// Index author, excerpt and domain for search as well
+	`DROP TRIGGER articles_ai;
+	DROP TRIGGER articles_ad;
+	DROP TRIGGER articles_au;
+	DROP TABLE articles_fts;
+	CREATE VIRTUAL TABLE articles_fts USING fts5(
+		title, text_content, author, excerpt, domain, content='articles', content_rowid='id'
+	);
+	INSERT INTO articles_fts(articles_fts) VALUES('rebuild');
+	CREATE TRIGGER articles_ai AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts(rowid, title, text_content, author, excerpt, domain)
+		VALUES (new.id, new.title, new.text_content, new.author, new.excerpt, new.domain);
+	END;
+	CREATE TRIGGER articles_ad AFTER DELETE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content, author, excerpt, domain)
+		VALUES ('delete', old.id, old.title, old.text_content, old.author, old.excerpt, old.domain);
+	END;
+	CREATE TRIGGER articles_au AFTER UPDATE OF title, text_content, author, excerpt, domain ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, text_content, author, excerpt, domain)
+		VALUES ('delete', old.id, old.title, old.text_content, old.author, old.excerpt, old.domain);
+		INSERT INTO articles_fts(rowid, title, text_content, author, excerpt, domain)
+		VALUES (new.id, new.title, new.text_content, new.author, new.excerpt, new.domain);
+	END`,
+	// Embedding vectors for similarity search, one per article and model.
+	// Vectors are dropped when the text they were computed from changes.
+	`CREATE TABLE article_vectors (
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		model TEXT NOT NULL,
+		vector BLOB NOT NULL,
+		PRIMARY KEY (article_id, model)
+	);
+	CREATE TRIGGER article_vectors_au AFTER UPDATE OF title, text_content ON articles BEGIN
+		DELETE FROM article_vectors WHERE article_id = new.id;
+	END`,
+	// Duplicate detection: the key of the saved URL and of the URL the page
+	// gave as canonical, and a hash of the text. fillDerivedColumns computes
+	// them for existing articles.
+	`ALTER TABLE articles ADD COLUMN url_key TEXT;
+	ALTER TABLE articles ADD COLUMN canonical_url TEXT;
+	ALTER TABLE articles ADD COLUMN canonical_key TEXT;
+	ALTER TABLE articles ADD COLUMN content_hash TEXT;
+	CREATE INDEX idx_articles_user_url_key ON articles(user_id, url_key);
+	CREATE INDEX idx_articles_user_canonical_key ON articles(user_id, canonical_key);
+	CREATE INDEX idx_articles_user_content_hash ON articles(user_id, content_hash)`,
+	// What extracted an article's content, and the publication time it found
+	`ALTER TABLE articles ADD COLUMN extractor TEXT;
+	ALTER TABLE articles ADD COLUMN published_at DATETIME`,
+	// What kind of failure fetch_error is, for clients to tell them apart
+	`ALTER TABLE articles ADD COLUMN fetch_error_kind TEXT NOT NULL DEFAULT ''`,
+	// Drop links to images that refreshed articles no longer show, and the
+	// images nothing links to any more
+	`DELETE FROM article_assets
+	WHERE NOT EXISTS (
+		SELECT 1 FROM articles a
+		WHERE a.id = article_assets.article_id
+			AND (instr(COALESCE(a.content, ''), article_assets.hash) > 0
+				OR instr(COALESCE(a.image_url, ''), article_assets.hash) > 0)
+	);
+	DELETE FROM assets WHERE hash NOT IN (SELECT hash FROM article_assets)`,
+	// Articles merged into an earlier save of the same page, so that their
+	// IDs still lead somewhere
+	`CREATE TABLE merged_articles (
+		id INTEGER PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_merged_articles_article ON merged_articles(article_id)`,
+}
+
+// Migrate brings the schema up to date. Foreign keys are switched off while
+// migrations run so that table rebuilds don't cascade deletes.
 func (s *SQLiteDB) Migrate() error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS articles (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			url TEXT UNIQUE NOT NULL,
-			title TEXT,
-			content TEXT,
-			text_content TEXT,
-			excerpt TEXT,
-			author TEXT,
-			image_url TEXT,
-			saved_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			read_at DATETIME,
-			archived INTEGER DEFAULT 0
-		)`,
-		`CREATE TABLE IF NOT EXISTS tags (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS article_tags (
-			article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
-			tag_id INTEGER REFERENCES tags(id) ON DELETE CASCADE,
-			PRIMARY KEY (article_id, tag_id)
-		)`,
-		`CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(
-			title, text_content, content='articles', content_rowid='id'
-		)`,
-		// Triggers to keep FTS in sync
-		`CREATE TRIGGER IF NOT EXISTS articles_ai AFTER INSERT ON articles BEGIN
-			INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
-		END`,
-		`CREATE TRIGGER IF NOT EXISTS articles_ad AFTER DELETE ON articles BEGIN
-			INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
-		END`,
-		`CREATE TRIGGER IF NOT EXISTS articles_au AFTER UPDATE ON articles BEGIN
-			INSERT INTO articles_fts(articles_fts, rowid, title, text_content) VALUES('delete', old.id, old.title, old.text_content);
-			INSERT INTO articles_fts(rowid, title, text_content) VALUES (new.id, new.title, new.text_content);
-		END`,
-	}
-
-	for _, m := range migrations {
-		if _, err := s.db.Exec(m); err != nil {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return s.fillDerivedColumns()
+}
+
+// fillDerivedColumns computes the word count, domain, URL key and content
+// hash of articles saved before those columns existed. New articles get them
+// when they are saved.
+func (s *SQLiteDB) fillDerivedColumns() error {
+	for {
+		rows, err := s.db.Query(`
+			SELECT id, url, COALESCE(text_content, '') FROM articles
+			WHERE word_count IS NULL OR domain IS NULL OR url_key IS NULL
+				OR (content_hash IS NULL AND COALESCE(text_content, '') != '')
+			LIMIT 100
+		`)
+		if err != nil {
+			return err
+		}
+
+		var batch []Article
+		for rows.Next() {
+			var a Article
+			if err := rows.Scan(&a.ID, &a.URL, &a.TextContent); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, a := range batch {
+			_, err := s.db.Exec("UPDATE articles SET word_count = ?, domain = ?, url_key = ?, content_hash = ? WHERE id = ?",
+				countWords(a.TextContent), articleDomain(a.URL), canonical.Key(a.URL), contentHash(a.TextContent), a.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
 
-// CreateArticle saves a new article and returns its ID
-func (s *SQLiteDB) CreateArticle(article *Article) (int64, error) {
-	result, err := s.db.Exec(`
-		INSERT INTO articles (url, title, content, text_content, excerpt, author, image_url)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, article.URL, article.Title, article.Content, article.TextContent, article.Excerpt, article.Author, article.ImageURL)
+// nullTime returns a pointer to a nullable column's time, or nil
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// formatTime formats a time the way SQLite's CURRENT_TIMESTAMP does, so
+// that stored timestamps sort correctly as text
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// summaryColumns are selected for article lists. Content and text_content
+// are left out to keep list responses small.
+const summaryColumns = `a.id, a.url, a.title, a.excerpt, a.author, a.image_url, a.saved_at, a.read_at, a.archived,
+	a.status, a.fetch_error, a.fetch_error_kind, a.progress, a.progress_offset, a.progress_at, a.last_opened_at, a.read_state,
+	a.favorite, a.favorited_at, a.domain, a.word_count`
+
+// scanSummary scans a row selected with summaryColumns followed by any extra
+// columns.
+func scanSummary(rows *sql.Rows, extra ...interface{}) (Article, error) {
+	var a Article
+	var archived, favorite int
+	var readAt, progressAt, lastOpenedAt, favoritedAt sql.NullTime
+
+	dest := []interface{}{
+		&a.ID, &a.URL, &a.Title, &a.Excerpt, &a.Author, &a.ImageURL, &a.SavedAt, &readAt, &archived,
+		&a.Status, &a.Error, &a.ErrorKind, &a.Progress, &a.ProgressOffset, &progressAt, &lastOpenedAt, &a.ReadState,
+		&favorite, &favoritedAt, &a.Domain, &a.WordCount,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return a, err
+	}
+
+	a.Archived = archived == 1
+	a.ReadAt = nullTime(readAt)
+	a.ProgressAt = nullTime(progressAt)
+	a.LastOpenedAt = nullTime(lastOpenedAt)
+	a.Favorite = favorite == 1
+	a.FavoritedAt = nullTime(favoritedAt)
+
+	return a, nil
+}
+
+// CreateArticle saves a new article for a user and returns its ID. Articles
+// without a status are stored as ready.
+func (s *SQLiteDB) CreateArticle(ctx context.Context, userID int64, article *Article) (int64, error) {
+	status := article.Status
+	if status == "" {
+		status = StatusReady
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO articles (user_id, url, title, content, text_content, excerpt, author, image_url, status,
+			domain, word_count, url_key, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, article.URL, article.Title, article.Content, article.TextContent, article.Excerpt, article.Author, article.ImageURL, status,
+		articleDomain(article.URL), countWords(article.TextContent), canonical.Key(article.URL), contentHash(article.TextContent))
 	if err != nil {
 		return 0, err
 	}
@@ -110,30 +551,234 @@ func (s *SQLiteDB) CreateArticle(article *Article) (int64, error) {
 	return result.LastInsertId()
 }
 
+// ImportArticle saves an article from another read-later service as pending,
+// keeping its original saved time, read state and tags. The article and its
+// tags are saved in one transaction, so a failure leaves nothing behind. It
+// returns created=false without an error if the user already has the URL or
+// another address of the same page.
+func (s *SQLiteDB) ImportArticle(ctx context.Context, userID int64, article *Article) (id int64, created bool, err error) {
+	if _, err := s.FindArticleByURL(ctx, userID, article.URL); err != ErrNotFound {
+		return 0, false, err
+	}
+
+	savedAt := article.SavedAt
+	if savedAt.IsZero() {
+		savedAt = time.Now().UTC()
+	}
+
+	archivedInt := 0
+	if article.Archived {
+		archivedInt = 1
+	}
+
+	var readAt interface{}
+	readState := ReadStateUnread
+	if article.ReadAt != nil {
+		readAt = formatTime(*article.ReadAt)
+		readState = ReadStateRead
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO articles (user_id, url, title, content, text_content, excerpt, author, image_url,
+			saved_at, read_at, read_state, archived, status, domain, word_count, url_key)
+		VALUES (?, ?, ?, '', '', '', '', '', ?, ?, ?, ?, ?, ?, 0, ?)
+		ON CONFLICT (user_id, url) DO NOTHING
+	`, userID, article.URL, article.Title, formatTime(savedAt), readAt, readState, archivedInt, StatusPending,
+		articleDomain(article.URL), canonical.Key(article.URL))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return 0, false, err
+	}
+
+	id, err = result.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, name := range article.Tags {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO tags (user_id, name) VALUES (?, ?)", userID, name); err != nil {
+			return 0, false, err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO article_tags (article_id, tag_id)
+			SELECT ?, id FROM tags WHERE user_id = ? AND name = ?
+		`, id, userID, name)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// CompleteArticle stores the parsed content of a pending article and marks it
+// ready. A title set at import time is kept if the page has none.
+func (s *SQLiteDB) CompleteArticle(ctx context.Context, id int64, parsed *Article) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE articles
+		SET title = COALESCE(NULLIF(?, ''), title), content = ?, text_content = ?, excerpt = ?, author = ?, image_url = ?,
+			word_count = ?, canonical_url = ?, canonical_key = ?, content_hash = ?, extractor = ?, published_at = ?,
+			status = ?, fetch_error = '', fetch_error_kind = ''
+		WHERE id = ?
+	`, parsed.Title, parsed.Content, parsed.TextContent, parsed.Excerpt, parsed.Author, parsed.ImageURL,
+		countWords(parsed.TextContent), nullString(parsed.CanonicalURL), nullString(canonical.Key(parsed.CanonicalURL)),
+		contentHash(parsed.TextContent), nullString(parsed.Extractor), publishedAt(parsed), StatusReady, id)
+	return err
+}
+
+// RefreshArticle replaces an article's content with a newly parsed version
+// of its page. It reports false, and leaves the article alone, if nothing
+// has changed.
+func (s *SQLiteDB) RefreshArticle(ctx context.Context, id int64, parsed *Article) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current Article
+	var status string
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(title, ''), COALESCE(content, ''), COALESCE(excerpt, ''), COALESCE(author, ''), COALESCE(image_url, ''), status
+		FROM articles WHERE id = ?
+	`, id).Scan(&current.Title, &current.Content, &current.Excerpt, &current.Author, &current.ImageURL, &status)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	title := parsed.Title
+	if title == "" {
+		title = current.Title
+	}
+	if status == StatusReady && title == current.Title && parsed.Content == current.Content &&
+		parsed.Excerpt == current.Excerpt && parsed.Author == current.Author && parsed.ImageURL == current.ImageURL {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE articles
+		SET title = ?, content = ?, text_content = ?, excerpt = ?, author = ?, image_url = ?,
+			word_count = ?, canonical_url = ?, canonical_key = ?, content_hash = ?, extractor = ?, published_at = ?,
+			status = ?, fetch_error = '', fetch_error_kind = ''
+		WHERE id = ?
+	`, title, parsed.Content, parsed.TextContent, parsed.Excerpt, parsed.Author, parsed.ImageURL,
+		countWords(parsed.TextContent), nullString(parsed.CanonicalURL), nullString(canonical.Key(parsed.CanonicalURL)),
+		contentHash(parsed.TextContent), nullString(parsed.Extractor), publishedAt(parsed), StatusReady, id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := pruneAssets(ctx, tx, id); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// publishedAt formats a parsed article's publication time for storage, or
+// returns nil if it has none
+func publishedAt(parsed *Article) interface{} {
+	if parsed.PublishedAt == nil {
+		return nil
+	}
+	return formatTime(*parsed.PublishedAt)
+}
+
+// FailArticle marks a pending article as failed and records the reason
+// and its kind
+func (s *SQLiteDB) FailArticle(ctx context.Context, id int64, kind, reason string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE articles SET status = ?, fetch_error = ?, fetch_error_kind = ? WHERE id = ?
+	`, StatusFailed, reason, kind, id)
+	return err
+}
+
+// ArticleStatus returns the status of an article of any user
+func (s *SQLiteDB) ArticleStatus(ctx context.Context, id int64) (string, error) {
+	var status string
+	err := s.db.QueryRowContext(ctx, "SELECT status FROM articles WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return status, err
+}
+
+// ListPendingArticles returns articles of all users that are still waiting
+// to be fetched, oldest first
+func (s *SQLiteDB) ListPendingArticles(ctx context.Context) ([]Article, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+summaryColumns+`
+		FROM articles a
+		WHERE a.status = ?
+		ORDER BY a.id
+	`, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []Article
+	for rows.Next() {
+		a, err := scanSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
+	}
+
+	return articles, rows.Err()
+}
+
 // GetArticle retrieves a single article by ID
-func (s *SQLiteDB) GetArticle(id int64) (*Article, error) {
+func (s *SQLiteDB) GetArticle(ctx context.Context, userID, id int64) (*Article, error) {
 	article := &Article{}
-	var archived int
-	var readAt sql.NullTime
+	var archived, favorite int
+	var readAt, progressAt, lastOpenedAt, favoritedAt, publishedAt sql.NullTime
 
-	err := s.db.QueryRow(`
-		SELECT id, url, title, content, text_content, excerpt, author, image_url, saved_at, read_at, archived
-		FROM articles WHERE id = ?
-	`, id).Scan(
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, url, title, content, text_content, excerpt, author, image_url, saved_at, read_at, archived,
+			status, fetch_error, fetch_error_kind, progress, progress_offset, progress_at, last_opened_at, read_state,
+			favorite, favorited_at, domain, word_count, COALESCE(canonical_url, ''), COALESCE(extractor, ''), published_at
+		FROM articles WHERE id = ? AND user_id = ?
+	`, id, userID).Scan(
 		&article.ID, &article.URL, &article.Title, &article.Content, &article.TextContent,
 		&article.Excerpt, &article.Author, &article.ImageURL, &article.SavedAt, &readAt, &archived,
+		&article.Status, &article.Error, &article.ErrorKind, &article.Progress, &article.ProgressOffset, &progressAt, &lastOpenedAt,
+		&article.ReadState, &favorite, &favoritedAt, &article.Domain, &article.WordCount, &article.CanonicalURL,
+		&article.Extractor, &publishedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	article.Archived = archived == 1
-	if readAt.Valid {
-		article.ReadAt = &readAt.Time
-	}
+	article.ReadAt = nullTime(readAt)
+	article.ProgressAt = nullTime(progressAt)
+	article.LastOpenedAt = nullTime(lastOpenedAt)
+	article.Favorite = favorite == 1
+	article.FavoritedAt = nullTime(favoritedAt)
+	article.PublishedAt = nullTime(publishedAt)
 
 	// Get tags
-	tags, err := s.GetArticleTags(id)
+	tags, err := s.GetArticleTags(ctx, userID, id)
 	if err != nil {
 		return nil, err
 	}
@@ -142,135 +787,394 @@ func (s *SQLiteDB) GetArticle(id int64) (*Article, error) {
 	return article, nil
 }
 
-// ListArticles returns articles with optional filtering
-func (s *SQLiteDB) ListArticles(archived *bool, limit, offset int) ([]Article, error) {
-	query := `
-		SELECT id, url, title, excerpt, author, image_url, saved_at, read_at, archived
-		FROM articles
-	`
-	args := []interface{}{}
-
-	if archived != nil {
-		if *archived {
-			query += " WHERE archived = 1"
-		} else {
-			query += " WHERE archived = 0"
-		}
+// ListArticles returns a page of articles matching a filter and the cursor
+// of the next page, which is empty on the last one
+func (s *SQLiteDB) ListArticles(ctx context.Context, userID int64, opts ListOptions) ([]Article, string, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortSavedAt
 	}
 
-	query += " ORDER BY saved_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
+	var where whereClause
+	opts.Filter.apply(&where)
+	p, err := opts.page(&where, nil)
+	if err != nil {
+		return nil, "", err
+	}
 
-	rows, err := s.db.Query(query, args...)
+	query := `
+		SELECT ` + summaryColumns + p.columns() + `
+		FROM articles a
+		WHERE a.user_id = ?` + where.String() + p.orderBy() + `
+		LIMIT ?`
+	args := append([]interface{}{userID}, where.args...)
+	args = append(args, opts.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var articles []Article
-	for rows.Next() {
-		var a Article
-		var archived int
-		var readAt sql.NullTime
+	return p.read(rows, nil)
+}
 
-		err := rows.Scan(&a.ID, &a.URL, &a.Title, &a.Excerpt, &a.Author, &a.ImageURL, &a.SavedAt, &readAt, &archived)
-		if err != nil {
-			return nil, err
-		}
+// CountArticles returns how many articles match a filter
+func (s *SQLiteDB) CountArticles(ctx context.Context, userID int64, filter Filter) (int, error) {
+	var where whereClause
+	filter.apply(&where)
 
-		a.Archived = archived == 1
-		if readAt.Valid {
-			a.ReadAt = &readAt.Time
-		}
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM articles a WHERE a.user_id = ?"+where.String(),
+		append([]interface{}{userID}, where.args...)...).Scan(&n)
+	return n, err
+}
 
-		articles = append(articles, a)
+// ArticleUpdate lists the changes to make to an article. Nil fields are
+// left alone.
+type ArticleUpdate struct {
+	Archived  *bool
+	ReadState *string
+	Favorite  *bool
+	Title     *string
+	// Content is the edited HTML and TextContent its plain text for search
+	Content     *string
+	TextContent *string
+}
+
+// UpdateArticle updates an article's archived, favorite or read state, or
+// its edited title or content. Starring an article records when, so lists
+// can be sorted by it. Marking an article read records when; any other read
+// state clears read_at. All the changes are made in one statement, so an
+// edit of both title and content is saved as one revision. Images that
+// edited content no longer shows are dropped.
+func (s *SQLiteDB) UpdateArticle(ctx context.Context, userID, id int64, update ArticleUpdate) error {
+	var sets []string
+	var args []interface{}
+
+	if archived := update.Archived; archived != nil {
+		sets = append(sets, "archived = ?")
+		args = append(args, *archived)
 	}
 
-	return articles, nil
-}
+	if favorite := update.Favorite; favorite != nil {
+		sets = append(sets, "favorite = ?", "favorited_at = CASE WHEN ? THEN COALESCE(favorited_at, CURRENT_TIMESTAMP) END")
+		args = append(args, *favorite, *favorite)
+	}
 
-// UpdateArticle updates an article's archived or read status
-func (s *SQLiteDB) UpdateArticle(id int64, archived *bool, markRead *bool) error {
-	if archived != nil {
-		archivedInt := 0
-		if *archived {
-			archivedInt = 1
-		}
-		if _, err := s.db.Exec("UPDATE articles SET archived = ? WHERE id = ?", archivedInt, id); err != nil {
-			return err
+	if state := update.ReadState; state != nil {
+		sets = append(sets, "read_state = ?", "read_at = CASE WHEN ? = 'read' THEN COALESCE(read_at, CURRENT_TIMESTAMP) END")
+		args = append(args, *state, *state)
+	}
+
+	if update.Title != nil {
+		sets = append(sets, "title = ?")
+		args = append(args, *update.Title)
+	}
+
+	if update.Content != nil {
+		var words int
+		var hash interface{}
+		if update.TextContent != nil {
+			words = countWords(*update.TextContent)
+			hash = contentHash(*update.TextContent)
 		}
+		sets = append(sets, "content = ?", "text_content = ?", "word_count = ?", "content_hash = ?")
+		args = append(args, *update.Content, update.TextContent, words, hash)
+	}
+
+	if len(sets) == 0 {
+		return s.checkArticle(ctx, userID, id)
 	}
 
-	if markRead != nil && *markRead {
-		if _, err := s.db.Exec("UPDATE articles SET read_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE articles SET "+strings.Join(sets, ", ")+" WHERE id = ? AND user_id = ?",
+		append(args, id, userID)...)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+
+	if update.Content != nil {
+		if err := pruneAssets(ctx, tx, id); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // DeleteArticle removes an article
-func (s *SQLiteDB) DeleteArticle(id int64) error {
-	_, err := s.db.Exec("DELETE FROM articles WHERE id = ?", id)
+func (s *SQLiteDB) DeleteArticle(ctx context.Context, userID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM articles WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// checkArticle returns ErrNotFound unless the article exists and belongs to
+// the user
+func (s *SQLiteDB) checkArticle(ctx context.Context, userID, id int64) error {
+	var exists int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM articles WHERE id = ? AND user_id = ?", id, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
 	return err
 }
 
-// Search performs full-text search on articles
-func (s *SQLiteDB) Search(query string, limit int) ([]Article, error) {
-	rows, err := s.db.Query(`
-		SELECT a.id, a.url, a.title, a.excerpt, a.author, a.image_url, a.saved_at, a.read_at, a.archived,
-			   snippet(articles_fts, 1, '<mark>', '</mark>', '...', 32) as snippet
-		FROM articles_fts f
-		JOIN articles a ON a.id = f.rowid
-		WHERE articles_fts MATCH ?
-		ORDER BY rank
+// expectRow turns an update or delete that matched nothing into ErrNotFound
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Search performs full-text search on articles and on the text and notes of
+// their highlights. An article matched through a highlight gets the
+// highlight as its snippet. Results are filtered and sorted like article
+// lists, by relevance unless another order is given, and paged with a
+// cursor. Each result has its score under the options' ranking.
+func (s *SQLiteDB) Search(ctx context.Context, userID int64, q SearchQuery, opts ListOptions) ([]Article, string, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortRelevance
+	}
+	ranking := opts.Ranking
+	if ranking == nil {
+		ranking = &DefaultRanking
+	}
+
+	source, args := q.source(ranking.Weights)
+	args = append(args, userID)
+
+	var where whereClause
+	q.apply(&where)
+	opts.Filter.apply(&where)
+	p, err := opts.page(&where, ranking.score)
+	if err != nil {
+		return nil, "", err
+	}
+	args = append(args, where.args...)
+	args = append(args, opts.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+summaryColumns+`, m.snippet, `+ranking.score(p.at)+p.columns()+`
+		FROM `+source+`
+		JOIN articles a ON a.id = m.id
+		WHERE a.user_id = ?`+where.String()+p.orderBy()+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	// Use snippet as excerpt for search results
+	var snippet string
+	var score float64
+	return p.read(rows, func(a *Article) {
+		if snippet != "" {
+			a.Excerpt = snippet
+		}
+		a.Score = new(float64)
+		*a.Score = score
+	}, &snippet, &score)
+}
+
+// searchResults returns the FROM and WHERE clauses selecting every article
+// that matches a search, for counting and facets. joins are added after the
+// articles table.
+func searchResults(userID int64, q SearchQuery, filter Filter, joins string) (string, []interface{}) {
+	source, args := q.source(DefaultRanking.Weights)
+	args = append(args, userID)
+
+	var where whereClause
+	q.apply(&where)
+	filter.apply(&where)
+
+	return `
+		FROM ` + source + `
+		JOIN articles a ON a.id = m.id` + joins + `
+		WHERE a.user_id = ?` + where.String(), append(args, where.args...)
+}
+
+// CountSearch returns how many articles match a search query and filter
+func (s *SQLiteDB) CountSearch(ctx context.Context, userID int64, q SearchQuery, filter Filter) (int, error) {
+	from, args := searchResults(userID, q, filter, "")
+
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&n)
+	return n, err
+}
+
+// Facet is a value search results can be narrowed by, with the number of
+// results that have it
+type Facet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets counts search results by tag and by domain, most common first
+type Facets struct {
+	Tags    []Facet `json:"tags"`
+	Domains []Facet `json:"domains"`
+}
+
+// maxFacets is how many values of each facet are returned
+const maxFacets = 20
+
+// SearchFacets counts the articles matching a search by tag and by domain
+func (s *SQLiteDB) SearchFacets(ctx context.Context, userID int64, q SearchQuery, filter Filter) (*Facets, error) {
+	from, args := searchResults(userID, q, filter, `
+		JOIN article_tags tagged ON tagged.article_id = a.id
+		JOIN tags tag ON tag.id = tagged.tag_id`)
+	tags, err := s.facet(ctx, `
+		SELECT tag.name, COUNT(*)`+from+`
+		GROUP BY tag.name ORDER BY COUNT(*) DESC, tag.name LIMIT ?
+	`, append(args, maxFacets)...)
+	if err != nil {
+		return nil, err
+	}
+
+	from, args = searchResults(userID, q, filter, "")
+	domains, err := s.facet(ctx, `
+		SELECT a.domain, COUNT(*)`+from+` AND a.domain != ''
+		GROUP BY a.domain ORDER BY COUNT(*) DESC, a.domain LIMIT ?
+	`, append(args, maxFacets)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Facets{Tags: tags, Domains: domains}, nil
+}
+
+// facet runs a query selecting a value and a count
+func (s *SQLiteDB) facet(ctx context.Context, query string, args ...interface{}) ([]Facet, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []Facet{}
+	for rows.Next() {
+		var f Facet
+		if err := rows.Scan(&f.Value, &f.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, f)
+	}
+	return facets, rows.Err()
+}
+
+// exportBatchSize is how many articles ExportArticles reads at a time
+const exportBatchSize = 100
+
+// exportKeys orders an export oldest first
+var exportKeys = []sortKey{{"a.saved_at", false}, {"a.id", false}}
+
+// ExportArticles calls fn for every article of a user, oldest first, with
+// content and tags. Articles are read in batches, and no query is open
+// while fn runs, so a slow client doesn't hold the database's read lock and
+// memory use doesn't grow with the size of the library.
+func (s *SQLiteDB) ExportArticles(ctx context.Context, userID int64, fn func(*Article) error) error {
+	var last []interface{}
+	for {
+		batch, err := s.exportBatch(ctx, userID, last)
+		if err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		a := batch[len(batch)-1]
+		last = []interface{}{formatTime(a.SavedAt), a.ID}
+	}
+}
+
+// exportBatch reads the articles after the given sort key values, or the
+// first ones if last is nil
+func (s *SQLiteDB) exportBatch(ctx context.Context, userID int64, last []interface{}) ([]Article, error) {
+	var where whereClause
+	if last != nil {
+		cond, args := after(exportKeys, last)
+		where.add(cond, args...)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.url, a.title, a.content, a.text_content, a.excerpt, a.author, a.image_url,
+			a.saved_at, a.read_at, a.read_state, a.archived, a.favorite, a.favorited_at, a.status, a.fetch_error,
+			COALESCE((
+				SELECT group_concat(t.name, char(31)) FROM tags t
+				JOIN article_tags at ON at.tag_id = t.id
+				WHERE at.article_id = a.id
+			), '')
+		FROM articles a
+		WHERE a.user_id = ?`+where.String()+`
+		ORDER BY a.saved_at, a.id
 		LIMIT ?
-	`, query, limit)
+	`, append(append([]interface{}{userID}, where.args...), exportBatchSize)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var articles []Article
+	var batch []Article
 	for rows.Next() {
 		var a Article
-		var archived int
-		var readAt sql.NullTime
-		var snippet string
+		var archived, favorite int
+		var readAt, favoritedAt sql.NullTime
+		var tags string
 
-		err := rows.Scan(&a.ID, &a.URL, &a.Title, &a.Excerpt, &a.Author, &a.ImageURL, &a.SavedAt, &readAt, &archived, &snippet)
+		err := rows.Scan(&a.ID, &a.URL, &a.Title, &a.Content, &a.TextContent, &a.Excerpt, &a.Author, &a.ImageURL,
+			&a.SavedAt, &readAt, &a.ReadState, &archived, &favorite, &favoritedAt, &a.Status, &a.Error, &tags)
 		if err != nil {
 			return nil, err
 		}
 
 		a.Archived = archived == 1
+		a.Favorite = favorite == 1
+		a.FavoritedAt = nullTime(favoritedAt)
 		if readAt.Valid {
 			a.ReadAt = &readAt.Time
 		}
-		// Use snippet as excerpt for search results
-		if snippet != "" {
-			a.Excerpt = snippet
+		if tags != "" {
+			a.Tags = strings.Split(tags, "\x1f")
 		}
-
-		articles = append(articles, a)
+		batch = append(batch, a)
 	}
-
-	return articles, nil
+	return batch, rows.Err()
 }
 
 // Tag operations
 
-func (s *SQLiteDB) CreateTag(name string) (int64, error) {
-	result, err := s.db.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name)
+func (s *SQLiteDB) CreateTag(ctx context.Context, userID int64, name string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO tags (user_id, name) VALUES (?, ?)", userID, name)
 	if err != nil {
 		return 0, err
 	}
 
 	id, err := result.LastInsertId()
-	if err != nil || id == 0 {
+	if n, _ := result.RowsAffected(); err != nil || n == 0 {
 		// Tag already exists, get its ID
-		err = s.db.QueryRow("SELECT id FROM tags WHERE name = ?", name).Scan(&id)
+		err = s.db.QueryRowContext(ctx, "SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&id)
 		if err != nil {
 			return 0, err
 		}
@@ -279,8 +1183,8 @@ func (s *SQLiteDB) CreateTag(name string) (int64, error) {
 	return id, nil
 }
 
-func (s *SQLiteDB) GetAllTags() ([]Tag, error) {
-	rows, err := s.db.Query("SELECT id, name FROM tags ORDER BY name")
+func (s *SQLiteDB) GetAllTags(ctx context.Context, userID int64) ([]Tag, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name FROM tags WHERE user_id = ? ORDER BY name", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -298,23 +1202,35 @@ func (s *SQLiteDB) GetAllTags() ([]Tag, error) {
 	return tags, nil
 }
 
-func (s *SQLiteDB) AddTagToArticle(articleID, tagID int64) error {
-	_, err := s.db.Exec("INSERT OR IGNORE INTO article_tags (article_id, tag_id) VALUES (?, ?)", articleID, tagID)
+// AddTagToArticle links a tag to an article. Both must belong to the user.
+func (s *SQLiteDB) AddTagToArticle(ctx context.Context, userID, articleID, tagID int64) error {
+	if err := s.checkArticle(ctx, userID, articleID); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO article_tags (article_id, tag_id)
+		SELECT ?, id FROM tags WHERE id = ? AND user_id = ?
+	`, articleID, tagID, userID)
 	return err
 }
 
-func (s *SQLiteDB) RemoveTagFromArticle(articleID, tagID int64) error {
-	_, err := s.db.Exec("DELETE FROM article_tags WHERE article_id = ? AND tag_id = ?", articleID, tagID)
+func (s *SQLiteDB) RemoveTagFromArticle(ctx context.Context, userID, articleID, tagID int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM article_tags
+		WHERE article_id = ? AND tag_id = ?
+			AND article_id IN (SELECT id FROM articles WHERE user_id = ?)
+	`, articleID, tagID, userID)
 	return err
 }
 
-func (s *SQLiteDB) GetArticleTags(articleID int64) ([]string, error) {
-	rows, err := s.db.Query(`
+func (s *SQLiteDB) GetArticleTags(ctx context.Context, userID, articleID int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
 		SELECT t.name FROM tags t
 		JOIN article_tags at ON at.tag_id = t.id
-		WHERE at.article_id = ?
+		WHERE at.article_id = ? AND t.user_id = ?
 		ORDER BY t.name
-	`, articleID)
+	`, articleID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -332,16 +1248,20 @@ func (s *SQLiteDB) GetArticleTags(articleID int64) ([]string, error) {
 	return tags, nil
 }
 
-func (s *SQLiteDB) GetArticlesByTag(tagName string, limit, offset int) ([]Article, error) {
-	rows, err := s.db.Query(`
-		SELECT a.id, a.url, a.title, a.excerpt, a.author, a.image_url, a.saved_at, a.read_at, a.archived
+// ListRefreshable returns the ID and URL of a user's articles that have
+// finished fetching, optionally only those with a tag
+func (s *SQLiteDB) ListRefreshable(ctx context.Context, userID int64, tag string) ([]Article, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.url
 		FROM articles a
-		JOIN article_tags at ON at.article_id = a.id
-		JOIN tags t ON t.id = at.tag_id
-		WHERE t.name = ?
-		ORDER BY a.saved_at DESC
-		LIMIT ? OFFSET ?
-	`, tagName, limit, offset)
+		WHERE a.user_id = ? AND a.status != ?
+			AND (? = '' OR EXISTS (
+				SELECT 1 FROM article_tags at
+				JOIN tags t ON t.id = at.tag_id
+				WHERE at.article_id = a.id AND t.user_id = a.user_id AND t.name = ?
+			))
+		ORDER BY a.id
+	`, userID, StatusPending, tag, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -350,21 +1270,10 @@ func (s *SQLiteDB) GetArticlesByTag(tagName string, limit, offset int) ([]Articl
 	var articles []Article
 	for rows.Next() {
 		var a Article
-		var archived int
-		var readAt sql.NullTime
-
-		err := rows.Scan(&a.ID, &a.URL, &a.Title, &a.Excerpt, &a.Author, &a.ImageURL, &a.SavedAt, &readAt, &archived)
-		if err != nil {
+		if err := rows.Scan(&a.ID, &a.URL); err != nil {
 			return nil, err
 		}
-
-		a.Archived = archived == 1
-		if readAt.Valid {
-			a.ReadAt = &readAt.Time
-		}
-
 		articles = append(articles, a)
 	}
-
-	return articles, nil
+	return articles, rows.Err()
 }
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+var testDBs atomic.Int64
+
+// newTestDB returns a migrated in-memory database. The cache is shared so
+// that every connection in the pool sees the same database.
+func newTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+	name := fmt.Sprintf("file:test%d?mode=memory&cache=shared", testDBs.Add(1))
+	db, err := NewSQLiteDB(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func newTestUser(t *testing.T, db *SQLiteDB, name string) int64 {
+	t.Helper()
+	user, err := db.CreateUser(context.Background(), name, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+func newTestArticle(t *testing.T, db *SQLiteDB, userID int64, a *Article) int64 {
+	t.Helper()
+	id, err := db.CreateArticle(context.Background(), userID, a)
+	if err != nil {
+		t.Fatalf("CreateArticle: %v", err)
+	}
+	return id
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+
+	var version int
+	if err := db.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("user_version = %d, want %d", version, len(migrations))
+	}
+
+	// Migrating again is a no-op
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+}
+
+func TestUpdateArticleRecordsOneRevision(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	id := newTestArticle(t, db, user, &Article{URL: "https://example.com/a", Title: "Old title", Content: "<p>old</p>", TextContent: "old"})
+
+	title, content, text := "New title", "<p>new body</p>", "new body"
+	read := ReadStateRead
+	err := db.UpdateArticle(ctx, user, id, ArticleUpdate{Title: &title, Content: &content, TextContent: &text, ReadState: &read})
+	if err != nil {
+		t.Fatalf("UpdateArticle: %v", err)
+	}
+
+	revisions, err := db.ListRevisions(ctx, user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("got %d revisions, want 1", len(revisions))
+	}
+	rev, err := db.GetRevision(ctx, user, id, revisions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Title != "Old title" || rev.Content != "<p>old</p>" {
+		t.Errorf("revision = %q, %q; want the old title and content", rev.Title, rev.Content)
+	}
+
+	a, err := db.GetArticle(ctx, user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != title || a.Content != content || a.WordCount != 2 || a.ReadState != read || a.ReadAt == nil {
+		t.Errorf("article = %+v", a)
+	}
+}
+
+func TestUpdateArticleNotFound(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	id := newTestArticle(t, db, alice, &Article{URL: "https://example.com/a", Title: "A"})
+
+	title := "Mine now"
+	if err := db.UpdateArticle(ctx, bob, id, ArticleUpdate{Title: &title}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of another user's article: err = %v, want ErrNotFound", err)
+	}
+	if err := db.UpdateArticle(ctx, bob, id, ArticleUpdate{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("empty update of another user's article: err = %v, want ErrNotFound", err)
+	}
+	if err := db.UpdateArticle(ctx, alice, id, ArticleUpdate{}); err != nil {
+		t.Errorf("empty update: %v", err)
+	}
+
+	a, err := db.GetArticle(ctx, alice, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "A" {
+		t.Errorf("title = %q, want it unchanged", a.Title)
+	}
+}
+
+func TestExportArticles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	alice := newTestUser(t, db, "alice")
+	bob := newTestUser(t, db, "bob")
+	newTestArticle(t, db, bob, &Article{URL: "https://example.com/bob"})
+
+	// More than a batch, mostly saved in the same second, so paging has to
+	// fall back on the ID
+	const n = exportBatchSize*2 + 7
+	for i := 0; i < n; i++ {
+		newTestArticle(t, db, alice, &Article{URL: fmt.Sprintf("https://example.com/%d", i), Title: fmt.Sprint(i)})
+	}
+	tagID, err := db.CreateTag(ctx, alice, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTagToArticle(ctx, alice, 2, tagID); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []int64
+	err = db.ExportArticles(ctx, alice, func(a *Article) error {
+		seen = append(seen, a.ID)
+		if a.ID == 2 && (len(a.Tags) != 1 || a.Tags[0] != "go") {
+			t.Errorf("article 2 tags = %v, want [go]", a.Tags)
+		}
+		// Writing while the export runs must not find the database locked
+		_, err := db.CreateTag(ctx, alice, fmt.Sprintf("during-%d", a.ID))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ExportArticles: %v", err)
+	}
+
+	if len(seen) != n {
+		t.Fatalf("exported %d articles, want %d", len(seen), n)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] <= seen[i-1] {
+			t.Fatalf("articles out of order at %d: %v", i, seen[i-1:i+1])
+		}
+	}
+}
+
+func TestImportArticle(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+
+	id, created, err := db.ImportArticle(ctx, user, &Article{URL: "https://example.com/a", Title: "A", Tags: []string{"go", "news"}})
+	if err != nil || !created {
+		t.Fatalf("ImportArticle = %d, %v, %v", id, created, err)
+	}
+	tags, err := db.GetArticleTags(ctx, user, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 {
+		t.Errorf("tags = %v, want go and news", tags)
+	}
+
+	// The same page under another address is a duplicate
+	if _, created, err := db.ImportArticle(ctx, user, &Article{URL: "https://www.example.com/a/?utm_source=x"}); err != nil || created {
+		t.Errorf("duplicate import: created = %v, err = %v", created, err)
+	}
+
+	// A failing tag leaves no half-imported article behind
+	_, err = db.db.Exec(`CREATE TRIGGER fail_bad_tag BEFORE INSERT ON tags WHEN new.name = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'bad tag'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.ImportArticle(ctx, user, &Article{URL: "https://example.com/b", Tags: []string{"ok", "bad"}}); err == nil {
+		t.Fatal("import with a failing tag succeeded")
+	}
+	if _, err := db.FindArticleByURL(ctx, user, "https://example.com/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindArticleByURL after failed import: err = %v, want ErrNotFound", err)
+	}
+	all, err := db.GetAllTags(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range all {
+		if tag.Name == "ok" {
+			t.Error("tag of the failed import was kept")
+		}
+	}
+}
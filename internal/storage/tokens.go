@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// APIToken describes a personal access token. The token itself is only
+// known to the client; the database keeps a hash and a short prefix so
+// users can tell their tokens apart.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateToken stores a hashed API token for a user
+func (s *SQLiteDB) CreateToken(ctx context.Context, userID int64, name, prefix, tokenHash string) (*APIToken, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, prefix, token_hash) VALUES (?, ?, ?, ?)
+	`, userID, name, prefix, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &APIToken{ID: id, Name: name, Prefix: prefix}
+	if err := s.db.QueryRowContext(ctx, "SELECT created_at FROM api_tokens WHERE id = ?", id).Scan(&token.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ListTokens returns a user's API tokens, newest first
+func (s *SQLiteDB) ListTokens(ctx context.Context, userID int64) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, prefix, created_at, last_used_at
+		FROM api_tokens WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+// DeleteToken revokes one of a user's API tokens
+func (s *SQLiteDB) DeleteToken(ctx context.Context, userID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// tokenUseInterval is how stale a token's last_used_at may get before it is
+// updated. Tokens authenticate every request, and writing on each one would
+// turn every read into a write.
+const tokenUseInterval = time.Minute
+
+// GetUserByTokenHash returns the owner of an API token and records that the
+// token was used, if it wasn't recorded in the last tokenUseInterval.
+// Recording the use is best-effort; a failure is logged and the user is
+// still returned.
+func (s *SQLiteDB) GetUserByTokenHash(ctx context.Context, tokenHash string) (*User, error) {
+	user := &User{}
+	var tokenID int64
+	var lastUsed sql.NullTime
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.created_at, t.id, t.last_used_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?
+	`, tokenHash).Scan(&user.ID, &user.Username, &user.CreatedAt, &tokenID, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !lastUsed.Valid || time.Since(lastUsed.Time) >= tokenUseInterval {
+		if _, err := s.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", tokenID); err != nil {
+			log.Printf("storage: token %d: failed to record use: %v", tokenID, err)
+		}
+	}
+
+	return user, nil
+}
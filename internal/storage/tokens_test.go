@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetUserByTokenHashRecordsUse(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	token, err := db.CreateToken(ctx, user, "laptop", "pc_1234", "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastUsed := func() *time.Time {
+		t.Helper()
+		tokens, err := db.ListTokens(ctx, user)
+		if err != nil || len(tokens) != 1 {
+			t.Fatalf("ListTokens = %v, %v", tokens, err)
+		}
+		return tokens[0].LastUsedAt
+	}
+	setLastUsed := func(at time.Time) {
+		t.Helper()
+		if _, err := db.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", formatTime(at), token.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := db.GetUserByTokenHash(ctx, "hash1"); err != nil || got.ID != user {
+		t.Fatalf("GetUserByTokenHash = %+v, %v", got, err)
+	}
+	if lastUsed() == nil {
+		t.Fatal("first use wasn't recorded")
+	}
+
+	// A recent use isn't written again
+	recent := time.Now().UTC().Add(-10 * time.Second).Truncate(time.Second)
+	setLastUsed(recent)
+	if _, err := db.GetUserByTokenHash(ctx, "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); got == nil || !got.Equal(recent) {
+		t.Errorf("last_used_at = %v, want it left at %v", got, recent)
+	}
+
+	// A stale one is
+	stale := time.Now().UTC().Add(-2 * tokenUseInterval)
+	setLastUsed(stale)
+	if _, err := db.GetUserByTokenHash(ctx, "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); got == nil || got.Before(recent) {
+		t.Errorf("last_used_at = %v, want it updated", got)
+	}
+
+	if _, err := db.GetUserByTokenHash(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown token: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetUserByTokenHashWithoutWrites(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	if _, err := db.CreateToken(ctx, user, "laptop", "pc_1234", "hash1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing to record a use doesn't fail authentication
+	_, err := db.db.Exec(`CREATE TRIGGER fail_token_use BEFORE UPDATE OF last_used_at ON api_tokens
+		BEGIN SELECT RAISE(ABORT, 'read-only'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.GetUserByTokenHash(ctx, "hash1"); err != nil || got.ID != user {
+		t.Errorf("GetUserByTokenHash = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUsersExist is returned by CreateFirstUser once any account exists
+var ErrUsersExist = errors.New("users already exist")
+
+type User struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateUser adds an account with an already hashed password. The first
+// account created also takes ownership of articles and tags saved before
+// accounts existed.
+func (s *SQLiteDB) CreateUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	return s.createUser(ctx, username, passwordHash, false)
+}
+
+// CreateFirstUser is CreateUser for anonymous signups: it only adds the
+// account if there are no accounts yet, and returns ErrUsersExist otherwise.
+// The check and the insert are one statement, so two concurrent signups
+// can't both succeed.
+func (s *SQLiteDB) CreateFirstUser(ctx context.Context, username, passwordHash string) (*User, error) {
+	return s.createUser(ctx, username, passwordHash, true)
+}
+
+func (s *SQLiteDB) createUser(ctx context.Context, username, passwordHash string, onlyFirst bool) (*User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO users (username, password_hash) VALUES (?, ?)"
+	if onlyFirst {
+		query = "INSERT INTO users (username, password_hash) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM users)"
+	}
+	result, err := tx.ExecContext(ctx, query, username, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrUsersExist
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return nil, err
+	}
+	if count == 1 {
+		if _, err := tx.ExecContext(ctx, "UPDATE articles SET user_id = ? WHERE user_id IS NULL", id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE tags SET user_id = ? WHERE user_id IS NULL", id); err != nil {
+			return nil, err
+		}
+	}
+
+	user := &User{ID: id, Username: username}
+	if err := tx.QueryRowContext(ctx, "SELECT created_at FROM users WHERE id = ?", id).Scan(&user.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return user, tx.Commit()
+}
+
+// GetUserByUsername returns a user and their password hash
+func (s *SQLiteDB) GetUserByUsername(ctx context.Context, username string) (*User, string, error) {
+	user := &User{}
+	var hash string
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, username, created_at, password_hash FROM users WHERE username = ?
+	`, username).Scan(&user.ID, &user.Username, &user.CreatedAt, &hash)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, hash, nil
+}
+
+// CountUsers returns the number of accounts
+func (s *SQLiteDB) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCreateFirstUser(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	user, err := db.CreateFirstUser(ctx, "alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateFirstUser: %v", err)
+	}
+	if user.ID == 0 || user.Username != "alice" {
+		t.Errorf("user = %+v", user)
+	}
+
+	if _, err := db.CreateFirstUser(ctx, "bob", "hash"); !errors.Is(err, ErrUsersExist) {
+		t.Errorf("second CreateFirstUser: err = %v, want ErrUsersExist", err)
+	}
+	if _, _, err := db.GetUserByUsername(ctx, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob was created: err = %v", err)
+	}
+
+	// Signed-in users can still add accounts
+	if _, err := db.CreateUser(ctx, "bob", "hash"); err != nil {
+		t.Errorf("CreateUser: %v", err)
+	}
+}
+
+func TestCreateFirstUserConcurrently(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	const signups = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < signups; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := db.CreateFirstUser(ctx, fmt.Sprint("user", i), "hash"); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count, err := db.CountUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || count != 1 {
+		t.Errorf("%d signups succeeded and %d users exist, want 1 of each", created, count)
+	}
+}
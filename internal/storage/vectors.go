@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ArticlesToEmbed returns up to limit ready articles, of any user, that
+// have no vector for model yet, with their title, excerpt and text
+func (s *SQLiteDB) ArticlesToEmbed(ctx context.Context, model string, limit int) ([]Article, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, COALESCE(a.title, ''), COALESCE(a.excerpt, ''), COALESCE(a.text_content, '')
+		FROM articles a
+		WHERE a.status = ? AND NOT EXISTS (
+			SELECT 1 FROM article_vectors v WHERE v.article_id = a.id AND v.model = ?
+		)
+		LIMIT ?
+	`, StatusReady, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []Article
+	for rows.Next() {
+		var a Article
+		if err := rows.Scan(&a.ID, &a.Title, &a.Excerpt, &a.TextContent); err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
+	}
+	return articles, rows.Err()
+}
+
+// ArticleToEmbed returns an article's title, excerpt and text, or
+// ErrNotFound if it isn't ready
+func (s *SQLiteDB) ArticleToEmbed(ctx context.Context, id int64) (*Article, error) {
+	a := &Article{ID: id}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(title, ''), COALESCE(excerpt, ''), COALESCE(text_content, '')
+		FROM articles WHERE id = ? AND status = ?
+	`, id, StatusReady).Scan(&a.Title, &a.Excerpt, &a.TextContent)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SaveArticleVector stores an article's vector for model, replacing any
+// earlier one
+func (s *SQLiteDB) SaveArticleVector(ctx context.Context, articleID int64, model string, vector []float32) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO article_vectors (article_id, model, vector) VALUES (?, ?, ?)
+		ON CONFLICT(article_id, model) DO UPDATE SET vector = excluded.vector
+	`, articleID, model, encodeVector(vector))
+	return err
+}
+
+// GetArticleVector returns the vector of one of a user's articles for
+// model. It returns a nil vector if the article exists but has none, such
+// as while it is still being fetched.
+func (s *SQLiteDB) GetArticleVector(ctx context.Context, userID, articleID int64, model string) ([]float32, error) {
+	if err := s.checkArticle(ctx, userID, articleID); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT vector FROM article_vectors WHERE article_id = ? AND model = ?",
+		articleID, model).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeVector(data), nil
+}
+
+// NearestOptions filters and limits a similarity search
+type NearestOptions struct {
+	Filter
+	Limit int
+	// Exclude is an article to leave out, such as the one similar articles
+	// are looked for
+	Exclude int64
+}
+
+// NearestArticles returns the user's articles whose vectors for model are
+// most similar to vector by cosine similarity, most similar first, with the
+// similarity as their score. Articles with nothing in common are left out.
+func (s *SQLiteDB) NearestArticles(ctx context.Context, userID int64, model string, vector []float32, opts NearestOptions) ([]Article, error) {
+	var where whereClause
+	opts.Filter.apply(&where)
+	if opts.Exclude != 0 {
+		where.add("a.id != ?", opts.Exclude)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, v.vector
+		FROM article_vectors v
+		JOIN articles a ON a.id = v.article_id
+		WHERE a.user_id = ? AND v.model = ?`+where.String(),
+		append([]interface{}{userID, model}, where.args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		id    int64
+		score float64
+	}
+	var matches []match
+	for rows.Next() {
+		var id int64
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if score := cosine(vector, decodeVector(data)); score > 0 {
+			matches = append(matches, match{id, score})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].id > matches[j].id
+	})
+	if len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+	}
+
+	ids := make([]interface{}, len(matches))
+	for i, m := range matches {
+		ids[i] = m.id
+	}
+	byID := make(map[int64]Article, len(matches))
+	if len(ids) > 0 {
+		rows, err := s.db.QueryContext(ctx, "SELECT "+summaryColumns+" FROM articles a WHERE a.id IN ("+placeholders(len(ids))+")", ids...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			a, err := scanSummary(rows)
+			if err != nil {
+				return nil, err
+			}
+			byID[a.ID] = a
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	articles := []Article{}
+	for _, m := range matches {
+		if a, ok := byID[m.id]; ok {
+			score := m.score
+			a.Score = &score
+			articles = append(articles, a)
+		}
+	}
+	return articles, nil
+}
+
+// encodeVector stores a vector as little-endian float32s
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, f := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(f))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 if their
+// lengths differ or either is zero
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
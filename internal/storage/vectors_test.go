@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"zero", []float32{0, 0, 0}, []float32{1, 2, 3}, 0},
+		{"both zero", []float32{0, 0}, []float32{0, 0}, 0},
+		{"lengths differ", []float32{1, 2}, []float32{1, 2, 3}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		got := cosine(tt.a, tt.b)
+		if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: cosine = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	vector := []float32{0, 1, -0.5, 3.25e-7, float32(math.Inf(1))}
+	got := decodeVector(encodeVector(vector))
+	if fmt.Sprint(got) != fmt.Sprint(vector) {
+		t.Errorf("decoded %v, want %v", got, vector)
+	}
+}
+
+func TestNearestArticles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := newTestUser(t, db, "alice")
+	other := newTestUser(t, db, "bob")
+	const model = "test"
+
+	save := func(userID int64, url string, vector []float32) int64 {
+		t.Helper()
+		id := newTestArticle(t, db, userID, &Article{URL: url, Title: url})
+		if err := db.SaveArticleVector(ctx, id, model, vector); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	source := save(user, "https://example.com/source", []float32{1, 0, 0})
+	near := save(user, "https://example.com/close", []float32{0.9, 0.1, 0})
+	farther := save(user, "https://example.com/farther", []float32{0.5, 0.5, 0})
+	archived := save(user, "https://example.com/archived", []float32{0.95, 0.05, 0})
+	save(user, "https://example.com/unrelated", []float32{0, 0, 1})
+	save(user, "https://example.com/opposite", []float32{-1, 0, 0})
+	save(other, "https://example.com/other-user", []float32{1, 0, 0})
+	// A vector of another model isn't compared
+	otherModel := newTestArticle(t, db, user, &Article{URL: "https://example.com/other-model"})
+	if err := db.SaveArticleVector(ctx, otherModel, "other", []float32{1, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	isArchived := true
+	if err := db.UpdateArticle(ctx, user, archived, ArticleUpdate{Archived: &isArchived}); err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := db.GetArticleVector(ctx, user, source, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetArticleVector(ctx, other, source, model); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetArticleVector(other user): err = %v, want ErrNotFound", err)
+	}
+
+	notArchived := false
+	tests := []struct {
+		name string
+		opts NearestOptions
+		want []int64
+	}{
+		{"all", NearestOptions{Limit: 10, Exclude: source}, []int64{archived, near, farther}},
+		{"limit", NearestOptions{Limit: 2, Exclude: source}, []int64{archived, near}},
+		{"without exclude", NearestOptions{Limit: 2}, []int64{source, archived}},
+		{"filtered", NearestOptions{Filter: Filter{Archived: &notArchived}, Limit: 10, Exclude: source}, []int64{near, farther}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			articles, err := db.NearestArticles(ctx, user, model, vector, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, a := range articles {
+				got = append(got, a.ID)
+				if a.Score == nil || *a.Score <= 0 || *a.Score > 1+1e-6 {
+					t.Errorf("article %d: score = %v", a.ID, a.Score)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Another user's articles are never returned
+	articles, err := db.NearestArticles(ctx, other, model, vector, NearestOptions{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].URL != "https://example.com/other-user" {
+		t.Errorf("other user's results = %+v", articles)
+	}
+}
@@ -1,21 +1,38 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"pocket-clone/internal/fetch"
+	"pocket-clone/internal/ingest"
+	"pocket-clone/internal/parser"
 	"pocket-clone/internal/server"
 	"pocket-clone/internal/storage"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+
 	port := flag.String("port", "8080", "Server port")
 	dbPath := flag.String("db", "./pocket.db", "Database file path")
+	workers := flag.Int("workers", 4, "Number of background article fetchers")
+	singleFile := flag.Bool("single-file", false, "Also store self-contained snapshots with stylesheets and images inlined")
+	rulesDir := flag.String("rules", "", "Directory of site extraction rules (host.txt files)")
+	allowPrivate := flag.Bool("allow-private", false, "Allow fetching from loopback, private and link-local addresses")
 	flag.Parse()
 
+	loadSiteRules(*rulesDir)
+	fetch.AllowPrivate = *allowPrivate
+
 	// Initialize database
 	db, err := storage.NewSQLiteDB(*dbPath)
 	if err != nil {
@@ -29,20 +46,41 @@ func main() {
 	}
 
 	// Create and start server
-	srv := server.New(db, *port)
+	queue := ingest.New(db, *workers)
+	queue.SingleFile = *singleFile
+	srv := server.New(db, queue, *port)
 
 	// Handle graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	done := make(chan struct{})
 	go func() {
 		<-quit
 		log.Println("Shutting down server...")
-		srv.Shutdown()
+		if err := srv.Shutdown(); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+		close(done)
 	}()
 
 	log.Printf("Starting server on http://localhost:%s", *port)
-	if err := srv.Start(); err != nil {
+	if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server error: %v", err)
 	}
+
+	// Wait for background work to drain before closing the database
+	<-done
+}
+
+// loadSiteRules registers the site extraction rules in dir, if one is set
+func loadSiteRules(dir string) {
+	if dir == "" {
+		return
+	}
+	n, err := parser.LoadSiteRules(dir, parser.Extractors)
+	if err != nil {
+		log.Fatalf("Failed to load site rules: %v", err)
+	}
+	log.Printf("Loaded %d site rules from %s", n, dir)
 }
@@ -38,15 +38,24 @@ const API = {
         return this.request(`/articles/${id}`);
     },
 
-    async listArticles(params = {}) {
+    // queryString turns list and search parameters into a query string.
+    // Array values, such as several tags, repeat the parameter.
+    queryString(params) {
         const query = new URLSearchParams();
-        if (params.archived !== undefined) query.set('archived', params.archived);
-        if (params.tag) query.set('tag', params.tag);
-        if (params.limit) query.set('limit', params.limit);
-        if (params.offset) query.set('offset', params.offset);
-
+        for (const [key, value] of Object.entries(params)) {
+            if (value === undefined || value === null || value === '') continue;
+            if (Array.isArray(value)) {
+                value.forEach(v => query.append(key, v));
+            } else {
+                query.set(key, value);
+            }
+        }
         const queryStr = query.toString();
-        return this.request('/articles' + (queryStr ? '?' + queryStr : ''));
+        return queryStr ? '?' + queryStr : '';
+    },
+
+    async listArticles(params = {}) {
+        return this.request('/articles' + this.queryString(params));
     },
 
     async updateArticle(id, updates) {
@@ -62,9 +71,26 @@ const API = {
         });
     },
 
+    async updateProgress(id, progress) {
+        return this.request(`/articles/${id}/progress`, {
+            method: 'PATCH',
+            body: JSON.stringify(progress),
+        });
+    },
+
+    async refreshArticle(id) {
+        return this.request(`/articles/${id}/refresh`, {
+            method: 'POST',
+        });
+    },
+
+    async similarArticles(id) {
+        return this.request(`/articles/${id}/similar?limit=20`);
+    },
+
     // Search
-    async search(query, limit = 20) {
-        return this.request(`/search?q=${encodeURIComponent(query)}&limit=${limit}`);
+    async search(query, params = {}) {
+        return this.request('/search' + this.queryString({ q: query, limit: 20, ...params }));
     },
 
     // Tags
@@ -3,7 +3,10 @@
 const App = {
     currentView: 'unread',
     currentArticle: null,
+    progressTimeout: null,
     articles: [],
+    nextCursor: null,
+    fetchPage: null,
     tags: [],
 
     init() {
@@ -57,6 +60,13 @@ const App = {
             }, 300);
         });
 
+        // Save the reading position while scrolling through an article
+        window.addEventListener('scroll', () => {
+            if (this.currentArticle && !this.progressTimeout) {
+                this.progressTimeout = setTimeout(() => this.saveProgress(), 2000);
+            }
+        });
+
         // Keyboard shortcuts
         document.addEventListener('keydown', (e) => {
             // Escape to close reader or modal
@@ -102,9 +112,10 @@ const App = {
         listEl.innerHTML = '<div class="loading"><span class="spinner"></span> Loading...</div>';
 
         try {
-            const archived = this.currentView === 'archive';
-            this.articles = await API.listArticles({ archived }) || [];
-            this.renderArticles();
+            const params = this.currentView === 'favorites'
+                ? { favorite: true, sort: 'favorited_at' }
+                : { archived: this.currentView === 'archive' };
+            await this.showPage(cursor => API.listArticles({ ...params, cursor }));
         } catch (error) {
             console.error('Failed to load articles:', error);
             listEl.innerHTML = '<div class="empty-state"><h3>Failed to load articles</h3><p>Please try again later.</p></div>';
@@ -124,18 +135,47 @@ const App = {
         }
     },
 
+    // showPage shows the first page of a list. fetchPage(cursor) returns a
+    // page of the list; it is called again for "Load more".
+    async showPage(fetchPage) {
+        const page = await fetchPage('');
+        this.fetchPage = fetchPage;
+        this.articles = page.articles;
+        this.nextCursor = page.next_cursor || null;
+        this.renderArticles();
+    },
+
+    async loadMore() {
+        try {
+            const page = await this.fetchPage(this.nextCursor);
+            this.articles = this.articles.concat(page.articles);
+            this.nextCursor = page.next_cursor || null;
+            this.renderArticles();
+        } catch (error) {
+            console.error('Failed to load articles:', error);
+            alert('Failed to load more articles');
+        }
+    },
+
     renderArticles() {
         const listEl = document.getElementById('article-list');
 
         if (!this.articles || this.articles.length === 0) {
-            const message = this.currentView === 'archive'
-                ? 'No archived articles yet'
-                : 'No articles saved. Click "+ Add" to save your first article!';
+            let message = 'No articles saved. Click "+ Add" to save your first article!';
+            if (this.currentView === 'archive') {
+                message = 'No archived articles yet';
+            } else if (this.currentView === 'favorites') {
+                message = 'No favorites yet';
+            }
             listEl.innerHTML = `<div class="empty-state"><h3>${message}</h3></div>`;
             return;
         }
 
         listEl.innerHTML = this.articles.map(article => this.renderArticleCard(article)).join('');
+        if (this.nextCursor) {
+            listEl.insertAdjacentHTML('beforeend', '<button class="btn load-more" id="load-more">Load more</button>');
+            document.getElementById('load-more').addEventListener('click', () => this.loadMore());
+        }
 
         // Bind click events
         listEl.querySelectorAll('.article-card').forEach(card => {
@@ -161,23 +201,37 @@ const App = {
     renderArticleCard(article) {
         const date = new Date(article.saved_at).toLocaleDateString();
         const imageHtml = article.image_url
-            ? `<img src="${article.image_url}" alt="" class="article-image" loading="lazy">`
+            ? `<img src="${this.escapeAttr(article.image_url)}" alt="" class="article-image" loading="lazy">`
             : '<div class="article-image"></div>';
 
+        const favoriteBtn = article.favorite
+            ? '<button class="btn btn-icon" data-action="unfavorite" title="Remove from favorites">★</button>'
+            : '<button class="btn btn-icon" data-action="favorite" title="Add to favorites">☆</button>';
+
         const archiveBtn = this.currentView === 'archive'
             ? '<button class="btn btn-icon" data-action="unarchive" title="Unarchive">📥</button>'
             : '<button class="btn btn-icon" data-action="archive" title="Archive">📦</button>';
 
+        let excerpt = article.excerpt || '';
+        if (article.status === 'pending') {
+            excerpt = 'Saving…';
+        } else if (article.status === 'failed') {
+            excerpt = 'Failed to fetch: ' + (article.error || 'unknown error');
+        }
+
         return `
             <article class="article-card" data-id="${article.id}">
                 ${imageHtml}
                 <div class="article-content">
-                    <h2 class="article-title">${this.escapeHtml(article.title || 'Untitled')}</h2>
-                    <p class="article-excerpt">${this.escapeHtml(article.excerpt || '')}</p>
+                    <h2 class="article-title">${this.escapeHtml(article.title || article.url || 'Untitled')}</h2>
+                    <p class="article-excerpt">${this.escapeHtml(excerpt)}</p>
                     <div class="article-meta">
                         <span>${date}</span>
                         ${article.author ? `<span>by ${this.escapeHtml(article.author)}</span>` : ''}
+                        ${article.word_count ? `<span>${Math.max(1, Math.round(article.word_count / 200))} min</span>` : ''}
+                        ${this.renderReadState(article)}
                         <div class="article-actions">
+                            ${favoriteBtn}
                             ${archiveBtn}
                             <button class="btn btn-icon" data-action="delete" title="Delete">🗑️</button>
                         </div>
@@ -187,6 +241,16 @@ const App = {
         `;
     },
 
+    renderReadState(article) {
+        if (article.read_state === 'read') {
+            return '<span>Read</span>';
+        }
+        if (article.read_state === 'in_progress') {
+            return `<span>${Math.round(article.progress)}% read</span>`;
+        }
+        return '';
+    },
+
     renderTags() {
         const listEl = document.getElementById('article-list');
 
@@ -208,8 +272,7 @@ const App = {
         listEl.querySelectorAll('[data-tag]').forEach(btn => {
             btn.addEventListener('click', async () => {
                 const tag = btn.dataset.tag;
-                this.articles = await API.listArticles({ tag }) || [];
-                this.renderArticles();
+                await this.showPage(cursor => API.listArticles({ tag, cursor }));
             });
         });
     },
@@ -218,9 +281,9 @@ const App = {
         try {
             this.currentArticle = await API.getArticle(id);
             this.renderReader();
-
-            // Mark as read
-            await API.updateArticle(id, { mark_read: true });
+            this.restoreProgress();
+            API.updateProgress(id, { opened_at: new Date().toISOString() })
+                .catch(error => console.error('Failed to save progress:', error));
         } catch (error) {
             console.error('Failed to load article:', error);
             alert('Failed to load article');
@@ -241,7 +304,13 @@ const App = {
                 <div class="reader-meta">
                     ${article.author ? `By ${this.escapeHtml(article.author)} • ` : ''}
                     Saved ${date}
-                    ${article.url ? ` • <a href="${article.url}" target="_blank" rel="noopener">Original</a>` : ''}
+                    ${article.url ? ` • <a href="${this.escapeAttr(article.url)}" target="_blank" rel="noopener">Original</a>` : ''}
+                    ${article.extractor === 'pdf'
+                        ? `• <a href="/api/articles/${article.id}/original" target="_blank" rel="noopener">PDF</a>`
+                        : `• <a href="/api/articles/${article.id}/snapshot" target="_blank" rel="noopener">Snapshot</a>`}
+                    • <a class="reader-refresh" id="reader-refresh">Refresh</a>
+                    • <a class="reader-refresh" id="reader-read">${article.read_state === 'read' ? 'Mark as unread' : 'Mark as read'}</a>
+                    • <a class="reader-refresh" id="reader-similar">More like this</a>
                 </div>
             </div>
             <div class="reader-content">
@@ -253,12 +322,93 @@ const App = {
             this.closeReader();
         });
 
+        document.getElementById('reader-refresh').addEventListener('click', async () => {
+            try {
+                this.currentArticle = await API.refreshArticle(article.id);
+                this.renderReader();
+            } catch (error) {
+                console.error('Failed to refresh article:', error);
+                alert('Failed to refresh article');
+            }
+        });
+
+        document.getElementById('reader-read').addEventListener('click', () => {
+            this.setReadState(article.read_state === 'read' ? 'unread' : 'read');
+        });
+
+        document.getElementById('reader-similar').addEventListener('click', () => {
+            this.showSimilar(article.id);
+        });
+
         listEl.classList.add('hidden');
         readerEl.classList.remove('hidden');
         window.scrollTo(0, 0);
     },
 
+    // readingPercent is how far the page is scrolled, from 0 to 100
+    readingPercent() {
+        const scrollable = document.documentElement.scrollHeight - window.innerHeight;
+        if (scrollable <= 0) {
+            return 100;
+        }
+        return Math.min(100, Math.max(0, window.scrollY / scrollable * 100));
+    },
+
+    restoreProgress() {
+        const progress = this.currentArticle.progress;
+        if (progress > 0 && progress < 100) {
+            const scrollable = document.documentElement.scrollHeight - window.innerHeight;
+            window.scrollTo(0, scrollable * progress / 100);
+        }
+    },
+
+    saveProgress() {
+        clearTimeout(this.progressTimeout);
+        this.progressTimeout = null;
+
+        const article = this.currentArticle;
+        if (!article) {
+            return;
+        }
+
+        const percent = this.readingPercent();
+        const text = article.text_content || '';
+        article.progress = percent;
+        if (percent > 0 && article.read_state === 'unread') {
+            article.read_state = 'in_progress';
+        }
+        API.updateProgress(article.id, {
+            percent,
+            offset: Math.round(text.length * percent / 100),
+            updated_at: new Date().toISOString(),
+        }).catch(error => console.error('Failed to save progress:', error));
+
+        // Reaching the end of an article marks it read
+        if (percent >= 99 && article.read_state !== 'read') {
+            this.setReadState('read');
+        }
+    },
+
+    async setReadState(state) {
+        const article = this.currentArticle;
+        if (!article) {
+            return;
+        }
+
+        try {
+            await API.updateArticle(article.id, { read_state: state });
+            article.read_state = state;
+            const link = document.getElementById('reader-read');
+            if (link) {
+                link.textContent = state === 'read' ? 'Mark as unread' : 'Mark as read';
+            }
+        } catch (error) {
+            console.error('Failed to update read state:', error);
+        }
+    },
+
     closeReader() {
+        this.saveProgress();
         this.currentArticle = null;
         document.getElementById('reader').classList.add('hidden');
         document.getElementById('article-list').classList.remove('hidden');
@@ -277,6 +427,19 @@ const App = {
                     this.articles = this.articles.filter(a => a.id !== id);
                     this.renderArticles();
                     break;
+                case 'favorite':
+                case 'unfavorite': {
+                    const favorite = action === 'favorite';
+                    await API.updateArticle(id, { favorite });
+                    if (this.currentView === 'favorites' && !favorite) {
+                        this.articles = this.articles.filter(a => a.id !== id);
+                    } else {
+                        const article = this.articles.find(a => a.id === id);
+                        if (article) article.favorite = favorite;
+                    }
+                    this.renderArticles();
+                    break;
+                }
                 case 'delete':
                     if (confirm('Delete this article?')) {
                         await API.deleteArticle(id);
@@ -315,8 +478,9 @@ const App = {
             const article = await API.createArticle(url);
             this.hideAddModal();
 
-            // Refresh list if on unread view
-            if (this.currentView === 'unread') {
+            // Refresh list if on unread view. Saving a page again returns
+            // the article that is already there.
+            if (this.currentView === 'unread' && !this.articles.some(a => a.id === article.id)) {
                 this.articles.unshift(article);
                 this.renderArticles();
             }
@@ -334,14 +498,26 @@ const App = {
         listEl.innerHTML = '<div class="loading"><span class="spinner"></span> Searching...</div>';
 
         try {
-            this.articles = await API.search(query) || [];
-            this.renderArticles();
+            await this.showPage(cursor => API.search(query, { cursor }));
         } catch (error) {
             console.error('Search failed:', error);
             listEl.innerHTML = '<div class="empty-state"><h3>Search failed</h3></div>';
         }
     },
 
+    async showSimilar(id) {
+        this.closeReader();
+        const listEl = document.getElementById('article-list');
+        listEl.innerHTML = '<div class="loading"><span class="spinner"></span> Loading...</div>';
+
+        try {
+            await this.showPage(() => API.similarArticles(id));
+        } catch (error) {
+            console.error('Failed to load similar articles:', error);
+            listEl.innerHTML = '<div class="empty-state"><h3>Failed to load similar articles</h3></div>';
+        }
+    },
+
     checkOnlineStatus() {
         this.updateOnlineStatus(navigator.onLine);
     },
@@ -356,6 +532,11 @@ const App = {
         const div = document.createElement('div');
         div.textContent = text;
         return div.innerHTML;
+    },
+
+    // escapeAttr escapes text for a quoted attribute value
+    escapeAttr(text) {
+        return this.escapeHtml(text).replace(/"/g, '&quot;').replace(/'/g, '&#39;');
     }
 };
 
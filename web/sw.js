@@ -1,5 +1,5 @@
 // Pocket Clone Service Worker
-const CACHE_NAME = 'pocket-clone-v1';
+const CACHE_NAME = 'pocket-clone-v6';
 const STATIC_ASSETS = [
     '/',
     '/index.html',